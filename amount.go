@@ -0,0 +1,78 @@
+package buddha
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// number of items, unmarshaled from a number such as 4 or a percentage of
+// a total such as "25%"
+type Amount struct {
+	N       int
+	Percent float64
+}
+
+func (a Amount) String() string {
+	if a.Percent > 0 {
+		return strconv.FormatFloat(a.Percent, 'f', -1, 64) + "%"
+	}
+
+	return strconv.Itoa(a.N)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.Percent > 0 {
+		return json.Marshal(a.String())
+	}
+
+	return json.Marshal(a.N)
+}
+
+func (a *Amount) UnmarshalJSON(p []byte) error {
+	s := string(p)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+
+	return nil
+}
+
+// return the number of items the amount represents out of total, rounded
+// down
+func (a Amount) Of(total int) int {
+	if a.Percent > 0 {
+		return int(float64(total) * a.Percent / 100)
+	}
+
+	return a.N
+}
+
+// parse amount string as a number or percentage
+func ParseAmount(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+
+	if strings.HasSuffix(str, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(str[:len(str)-1]), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Amount{}, fmt.Errorf("invalid percentage: %s", s)
+		}
+
+		return Amount{Percent: percent}, nil
+	}
+
+	n, err := strconv.Atoi(str)
+	if err != nil || n < 0 {
+		return Amount{}, fmt.Errorf("invalid amount: %s", s)
+	}
+
+	return Amount{N: n}, nil
+}
@@ -0,0 +1,54 @@
+package buddha
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]Amount{
+		"4":     {N: 4},
+		"0":     {},
+		"25%":   {Percent: 25},
+		"12.5%": {Percent: 12.5},
+	}
+
+	for s, expected := range tests {
+		a, err := ParseAmount(s)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		} else if a != expected {
+			t.Fatalf("expected %s to be %v, got %v", s, expected, a)
+		}
+	}
+
+	for _, s := range []string{"", "-1", "150%", "four"} {
+		if _, err := ParseAmount(s); err == nil {
+			t.Fatalf("expected error parsing %q, got nil", s)
+		}
+	}
+}
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	var v struct {
+		A Amount `json:"a"`
+		B Amount `json:"b"`
+	}
+
+	err := json.Unmarshal([]byte(`{"a": 3, "b": "50%"}`), &v)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if v.A.Of(16) != 3 {
+		t.Fatal("expected 3, got", v.A.Of(16))
+	}
+
+	if v.B.Of(16) != 8 {
+		t.Fatal("expected 8, got", v.B.Of(16))
+	}
+
+	if s := v.B.String(); s != "50%" {
+		t.Fatal("expected 50%, got", s)
+	}
+}
@@ -0,0 +1,63 @@
+package buddha
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// exponential backoff policy between check attempts. the first wait is the
+// check interval, which is multiplied after each subsequent failure.
+type Backoff struct {
+	// multiplier applied to the wait after each failed attempt, default 2
+	Multiplier float64 `json:"multiplier,omitempty"`
+
+	// maximum wait between attempts
+	Max Duration `json:"max,omitempty"`
+
+	// fraction of the wait, between 0 and 1, randomly added or subtracted
+	Jitter float64 `json:"jitter,omitempty"`
+
+	// total time to keep retrying, replacing the failures limit when set
+	Deadline Duration `json:"deadline,omitempty"`
+}
+
+// return the wait after failed attempt n, starting at 1. a nil Backoff
+// always waits the interval.
+func (b *Backoff) Next(interval time.Duration, attempt int) time.Duration {
+	if b == nil || attempt < 1 {
+		return interval
+	}
+
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	wait := float64(interval) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && wait > float64(b.Max) {
+		wait = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		wait += wait * b.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return time.Duration(wait)
+}
+
+// return the wait before the next attempt after failed attempt n, or false if
+// no attempts remain. elapsed is the time since the first attempt began.
+func (s CheckSettings) Retry(attempt int, elapsed time.Duration) (time.Duration, bool) {
+	wait := s.Backoff.Next(s.Interval.Duration(), attempt)
+
+	if s.Backoff != nil && s.Backoff.Deadline > 0 {
+		return wait, elapsed+wait < s.Backoff.Deadline.Duration()
+	}
+
+	return wait, attempt < s.Failures
+}
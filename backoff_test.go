@@ -0,0 +1,59 @@
+package buddha
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNextNil(t *testing.T) {
+	var b *Backoff
+
+	if d := b.Next(2*time.Second, 3); d != 2*time.Second {
+		t.Fatal("expected 2s, got", d)
+	}
+}
+
+func TestBackoffNext(t *testing.T) {
+	b := &Backoff{Multiplier: 2, Max: Duration(5 * time.Second)}
+
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if d := b.Next(1*time.Second, i+1); d != e {
+			t.Fatalf("expected attempt %d to wait %s, got %s", i+1, e, d)
+		}
+	}
+}
+
+func TestBackoffNextJitter(t *testing.T) {
+	b := &Backoff{Multiplier: 1, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		if d := b.Next(2*time.Second, 1); d < 1*time.Second || d > 3*time.Second {
+			t.Fatal("expected wait within 1s-3s, got", d)
+		}
+	}
+}
+
+func TestCheckSettingsRetry(t *testing.T) {
+	s := CheckSettings{Interval: Duration(1 * time.Second), Failures: 2}
+
+	if d, ok := s.Retry(1, 0); !ok || d != 1*time.Second {
+		t.Fatal("expected retry after 1s, got", d, ok)
+	} else if _, ok := s.Retry(2, 0); ok {
+		t.Fatal("expected no retry after failures exhausted")
+	}
+}
+
+func TestCheckSettingsRetryDeadline(t *testing.T) {
+	s := CheckSettings{
+		Interval: Duration(1 * time.Second),
+		Failures: 1,
+		Backoff:  &Backoff{Deadline: Duration(10 * time.Second)},
+	}
+
+	if d, ok := s.Retry(3, 2*time.Second); !ok || d != 4*time.Second {
+		t.Fatal("expected retry after 4s, got", d, ok)
+	} else if _, ok := s.Retry(4, 3*time.Second); ok {
+		t.Fatal("expected no retry past deadline")
+	}
+}
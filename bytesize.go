@@ -0,0 +1,82 @@
+package buddha
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// size in bytes, unmarshaled from a number of bytes or a string with a
+// binary unit suffix, such as "512M" or "10GB"
+type ByteSize uint64
+
+const (
+	Kilobyte ByteSize = 1 << (10 * (iota + 1))
+	Megabyte
+	Gigabyte
+	Terabyte
+)
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"T", Terabyte},
+	{"G", Gigabyte},
+	{"M", Megabyte},
+	{"K", Kilobyte},
+}
+
+func (b ByteSize) String() string {
+	for _, unit := range byteSizeUnits {
+		if b >= unit.size && b%unit.size == 0 {
+			return strconv.FormatUint(uint64(b/unit.size), 10) + unit.suffix
+		}
+	}
+
+	return strconv.FormatUint(uint64(b), 10)
+}
+
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func (b *ByteSize) UnmarshalJSON(p []byte) error {
+	s := string(p)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+
+	*b = size
+
+	return nil
+}
+
+// parse size string with optional K, M, G or T suffix
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "I")
+
+	multiplier := ByteSize(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			multiplier = unit.size
+			str = strings.TrimSpace(str[:len(str)-1])
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size: %s", s)
+	}
+
+	return ByteSize(n * float64(multiplier)), nil
+}
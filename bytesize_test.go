@@ -0,0 +1,66 @@
+package buddha
+
+import (
+	"testing"
+)
+
+func TestByteSizeString(t *testing.T) {
+	if s := ByteSize(512).String(); s != "512" {
+		t.Fatal("expected 512, got", s)
+	}
+
+	if s := (10 * Gigabyte).String(); s != "10G" {
+		t.Fatal("expected 10G, got", s)
+	}
+
+	if s := (1536 * Kilobyte).String(); s != "1536K" {
+		t.Fatal("expected 1536K, got", s)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{
+		"1024":  1024,
+		"1K":    Kilobyte,
+		"512M":  512 * Megabyte,
+		"10GB":  10 * Gigabyte,
+		"1GiB":  Gigabyte,
+		"1.5g":  1536 * Megabyte,
+		"2 TB":  2 * Terabyte,
+		"100kb": 100 * Kilobyte,
+	}
+
+	for s, expected := range tests {
+		b, err := ParseByteSize(s)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		} else if b != expected {
+			t.Fatalf("expected %s to be %d, got %d", s, expected, b)
+		}
+	}
+
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestByteSizeUnmarshalJSON(t *testing.T) {
+	var b ByteSize
+	err := b.UnmarshalJSON([]byte(`"10G"`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if b != 10*Gigabyte {
+		t.Fatal("expected 10G, got", b)
+	}
+
+	err = b.UnmarshalJSON([]byte(`4096`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if b != 4*Kilobyte {
+		t.Fatal("expected 4K, got", b)
+	}
+}
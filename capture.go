@@ -0,0 +1,194 @@
+package buddha
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// capture of stdout into a variable which later commands and checks of the
+// same job may refer to as ${var}
+type Capture struct {
+	// name of variable
+	Var string `json:"var"`
+
+	// regular expression matched against stdout, the value is its first
+	// group or, without groups, the whole match. default is all of stdout
+	// with surrounding whitespace trimmed.
+	Match string `json:"match,omitempty"`
+}
+
+func (c Capture) Validate() error {
+	if c.Var == "" {
+		return fmt.Errorf("expected capture variable name")
+	}
+
+	if _, err := regexp.Compile(c.Match); err != nil {
+		return fmt.Errorf("invalid capture match pattern: %s", err)
+	}
+
+	return nil
+}
+
+// return the value captured from stdout
+func (c Capture) Value(stdout string) (string, error) {
+	if c.Match == "" {
+		return strings.TrimSpace(stdout), nil
+	}
+
+	re, err := regexp.Compile(c.Match)
+	if err != nil {
+		return "", err
+	}
+
+	match := re.FindStringSubmatch(stdout)
+	if match == nil {
+		return "", fmt.Errorf("capture %s: output did not match %q", c.Var, c.Match)
+	}
+
+	if len(match) > 1 {
+		return match[1], nil
+	}
+
+	return match[0], nil
+}
+
+// checks which capture their output into a variable implement Capturer
+type Capturer interface {
+	// name of the variable captured, empty if none
+	CaptureVar() string
+
+	// value captured by the last execution, false if none was captured
+	Captured() (string, bool)
+}
+
+// variables captured while a job runs
+type Captures struct {
+	mu     sync.Mutex
+	names  map[string]bool // variables declared by the job
+	values map[string]string
+}
+
+// return captures of the variables declared by the commands and checks of job
+func NewCaptures(job *Job) *Captures {
+	return &Captures{
+		names:  job.captureVars(),
+		values: make(map[string]string),
+	}
+}
+
+// record the value of a captured variable, returning true if it changed
+func (c *Captures) Set(name, value string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.values[name]
+	c.values[name] = value
+
+	return !ok || previous != value
+}
+
+// return a copy of the values captured so far
+func (c *Captures) Values() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make(map[string]string, len(c.values))
+	for name, value := range c.values {
+		values[name] = value
+	}
+
+	return values
+}
+
+// substitute captured variables in the string fields of cmd and its checks.
+// an error is returned if cmd refers to a variable not yet captured.
+func (c *Captures) Substitute(cmd *Command) error {
+	// rollback commands are substituted when they run
+	rollback := cmd.Rollback
+	cmd.Rollback = nil
+	defer func() { cmd.Rollback = rollback }()
+
+	return c.substitute(reflect.ValueOf(cmd))
+}
+
+// substitute captured variables in the string fields of checks, such as
+// those of a job
+func (c *Captures) SubstituteChecks(checks Checks) error {
+	return c.substitute(reflect.ValueOf(checks))
+}
+
+func (c *Captures) substitute(v reflect.Value) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	undefined := make(map[string]bool)
+	lookup := func(name string) (string, bool) {
+		if value, ok := c.values[name]; ok {
+			return value, true
+		}
+
+		if c.names[name] {
+			return "", false
+		}
+
+		// not a capture, so left as it is
+		return "${" + name + "}", true
+	}
+
+	resolveStrings(v, func(s string) string {
+		return expandVars(s, lookup, undefined, false)
+	})
+
+	if len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return fmt.Errorf("variables not captured yet: %s", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// return the names of variables captured by the commands and checks of the job
+func (j *Job) captureVars() map[string]bool {
+	names := make(map[string]bool)
+
+	for _, checks := range []Checks{j.Before, j.After, j.Invariants} {
+		checks.captureVars(names)
+	}
+
+	for _, commands := range []Commands{j.Commands, j.Rollback, j.Finally} {
+		commands.captureVars(names)
+	}
+
+	return names
+}
+
+func (c Commands) captureVars(names map[string]bool) {
+	for _, cmd := range c {
+		if cmd.Capture != nil {
+			names[cmd.Capture.Var] = true
+		}
+
+		for _, checks := range []Checks{cmd.Necessity, cmd.Before, cmd.After} {
+			checks.captureVars(names)
+		}
+
+		cmd.Rollback.captureVars(names)
+	}
+}
+
+func (c Checks) captureVars(names map[string]bool) {
+	for _, check := range c {
+		if capturer, ok := check.(Capturer); ok && capturer.CaptureVar() != "" {
+			names[capturer.CaptureVar()] = true
+		}
+	}
+}
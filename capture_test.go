@@ -0,0 +1,133 @@
+package buddha
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCaptureValue(t *testing.T) {
+	stdout := "app 1.2.3\nbuilt 2016-11-01\n"
+
+	tests := []struct {
+		capture  Capture
+		expected string
+	}{
+		{Capture{Var: "v"}, "app 1.2.3\nbuilt 2016-11-01"},
+		{Capture{Var: "v", Match: `app (\S+)`}, "1.2.3"},
+		{Capture{Var: "v", Match: `\d{4}-\d{2}-\d{2}`}, "2016-11-01"},
+	}
+
+	for _, test := range tests {
+		value, err := test.capture.Value(stdout)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		} else if value != test.expected {
+			t.Fatalf("expected %q, got %q", test.expected, value)
+		}
+	}
+
+	_, err := Capture{Var: "v", Match: "missing"}.Value(stdout)
+	if err == nil {
+		t.Fatal("expected error when match fails")
+	}
+}
+
+func TestCaptureValidate(t *testing.T) {
+	if err := (Capture{Match: "a"}).Validate(); err == nil {
+		t.Fatal("expected error without var")
+	}
+
+	if err := (Capture{Var: "v", Match: "("}).Validate(); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func TestCapturesSubstitute(t *testing.T) {
+	jobs, err := Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "version", "path": "app", "capture": {"var": "version"}},
+		{"name": "deploy", "path": "deploy", "args": ["${version}", "${HOME}"],
+		 "after": [{"type": "exec", "name": "pid", "path": "pidof", "args": ["app"], "capture": {"var": "pid"}}],
+		 "rollback": [{"name": "restore", "path": "restore", "args": ["${pid}"]}]},
+		{"name": "check", "path": "check", "args": ["${pid}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// captured variables are left for substitution at run time
+	err = jobs.Resolve(map[string]string{"HOME": "/home/app"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	job := jobs[0]
+	captures := NewCaptures(job)
+
+	deploy := job.Commands[1]
+	if args := strings.Join(deploy.Args, " "); args != "${version} /home/app" {
+		t.Fatal("expected version to be left unresolved, got", args)
+	}
+
+	if err := captures.Substitute(&deploy); err == nil {
+		t.Fatal("expected error substituting variable not captured yet")
+	}
+
+	captures.Set("version", "1.2.3")
+	deploy = job.Commands[1]
+	if err := captures.Substitute(&deploy); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if args := strings.Join(deploy.Args, " "); args != "1.2.3 /home/app" {
+		t.Fatal("expected captured version, got", args)
+	} else if args := deploy.Rollback[0].Args[0]; args != "${pid}" {
+		t.Fatal("expected rollback to be substituted when run, got", args)
+	}
+
+	captures.Set("pid", "42")
+	check := job.Commands[2]
+	if err := captures.Substitute(&check); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if check.Args[0] != "42" {
+		t.Fatal("expected captured pid, got", check.Args[0])
+	}
+
+	if values := captures.Values(); len(values) != 2 || values["pid"] != "42" {
+		t.Fatal("expected captured values, got", values)
+	}
+
+	checks := Checks{CheckTCP{Name: "app", Addr: "127.0.0.1:${pid}"}}
+	if err := captures.SubstituteChecks(checks); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if addr := checks[0].(CheckTCP).Addr; addr != "127.0.0.1:42" {
+		t.Fatal("expected captured pid in check, got", addr)
+	}
+}
+
+func TestCheckExecCapture(t *testing.T) {
+	c := &CheckExec{
+		Path:    "echo",
+		Args:    []string{"pid 42"},
+		Capture: &Capture{Var: "pid", Match: `pid (\d+)`},
+	}
+
+	if _, ok := c.Captured(); ok {
+		t.Fatal("expected nothing captured before execution")
+	}
+
+	err := c.ExecuteContext(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if value, ok := c.Captured(); !ok || value != "42" {
+		t.Fatal("expected 42 to be captured, got", value)
+	}
+
+	c.Args = []string{"none"}
+	err = c.ExecuteContext(context.Background())
+	if err == nil {
+		t.Fatal("expected error when output does not match")
+	} else if _, ok := c.Captured(); ok {
+		t.Fatal("expected nothing captured from failed execution")
+	}
+}
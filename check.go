@@ -1,6 +1,7 @@
 package buddha
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -19,12 +20,132 @@ type Check interface {
 	Execute(time.Duration) error
 }
 
+// checks which support cancellation implement ContextCheck, the context
+// carries the check timeout as its deadline
+type ContextCheck interface {
+	Check
+
+	// execute health check until complete or ctx is done
+	ExecuteContext(ctx context.Context) error
+}
+
+// execute check with timeout, returning early with the context error if ctx
+// is done. checks not implementing ContextCheck are left to finish in the
+// background and have their result discarded.
+func ExecuteCheck(ctx context.Context, check Check, timeout time.Duration) error {
+	if c, ok := check.(ContextCheck); ok {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return c.ExecuteContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- check.Execute(timeout)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checks which need to observe the system before the command executes, such
+// as recording a position to compare against, implement Preparer
+type Preparer interface {
+	// called once immediately before the command executes, ctx carries the
+	// check timeout as its deadline
+	Prepare(ctx context.Context) error
+}
+
+// health check settings which may be set on individual checks to override
+// those of the command. zero values inherit the command setting.
+type CheckSettings struct {
+	// maximum time for check execution
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// timeout between health checks
+	Interval Duration `json:"interval,omitempty"`
+
+	// maximum health check failures before failing
+	Failures int `json:"failures,omitempty"`
+
+	// consecutive successes required before the check passes, default 1
+	Successes int `json:"successes,omitempty"`
+
+	// backoff policy between attempts, default is a fixed interval
+	Backoff *Backoff `json:"backoff,omitempty"`
+}
+
+// checks embedding CheckSettings implement Settings
+func (s CheckSettings) Settings() CheckSettings {
+	return s
+}
+
+// return settings with unset values taken from defaults
+func (s CheckSettings) Inherit(defaults CheckSettings) CheckSettings {
+	if s.Timeout == 0 {
+		s.Timeout = defaults.Timeout
+	}
+
+	if s.Interval == 0 {
+		s.Interval = defaults.Interval
+	}
+
+	if s.Failures == 0 {
+		s.Failures = defaults.Failures
+	}
+
+	if s.Successes == 0 {
+		s.Successes = defaults.Successes
+	}
+
+	if s.Backoff == nil {
+		s.Backoff = defaults.Backoff
+	}
+
+	if s.Successes < 1 {
+		s.Successes = 1
+	}
+
+	return s
+}
+
+// return the effective settings for check, inheriting unset values from defaults
+func SettingsFor(check Check, defaults CheckSettings) CheckSettings {
+	if c, ok := check.(interface {
+		Settings() CheckSettings
+	}); ok {
+		return c.Settings().Inherit(defaults)
+	}
+
+	return CheckSettings{}.Inherit(defaults)
+}
+
 type CheckFalse string
 
 func (e CheckFalse) Error() string {
 	return string(e)
 }
 
+// false result which retrying cannot change, such as a log file matching a
+// failure pattern, ending retries of the check immediately
+type CheckFalseFinal string
+
+func (e CheckFalseFinal) Error() string {
+	return string(e)
+}
+
 type Checks []Check
 
 // contextual unmarshaler into check types for interface
@@ -68,7 +189,62 @@ func (c *Checks) UnmarshalJSON(p []byte) error {
 				return err
 			}
 
-			*c = append(*c, exec)
+			*c = append(*c, &exec)
+
+		case "log":
+			var log CheckLog
+			err := json.Unmarshal(r, &log)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, &log)
+
+		case "connections":
+			var connections CheckConnections
+			err := json.Unmarshal(r, &connections)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, connections)
+
+		case "listen":
+			var listen CheckListen
+			err := json.Unmarshal(r, &listen)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, listen)
+
+		case "resources":
+			var resources CheckResources
+			err := json.Unmarshal(r, &resources)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, resources)
+
+		case "version":
+			var version CheckVersion
+			err := json.Unmarshal(r, &version)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, &version)
+
+		case "changed":
+			var changed CheckChanged
+			err := json.Unmarshal(r, &changed)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, &changed)
+
 		default:
 			return fmt.Errorf("Unknown check type %s", generic.Type)
 		}
@@ -77,6 +253,83 @@ func (c *Checks) UnmarshalJSON(p []byte) error {
 	return nil
 }
 
+// marshal checks with their type, as unmarshaled by UnmarshalJSON
+func (c Checks) MarshalJSON() ([]byte, error) {
+	raw := make([]json.RawMessage, len(c))
+	for i, check := range c {
+		typ, err := checkType(check)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := json.Marshal(check)
+		if err != nil {
+			return nil, err
+		}
+
+		// insert type as the first field of the object
+		if len(p) > 2 {
+			p = append([]byte(`{"type":"`+typ+`",`), p[1:]...)
+		} else {
+			p = []byte(`{"type":"` + typ + `"}`)
+		}
+
+		raw[i] = p
+	}
+
+	return json.Marshal(raw)
+}
+
+// return the type name of check
+func checkType(check Check) (string, error) {
+	switch check.(type) {
+	case CheckHTTP:
+		return "http", nil
+	case CheckTCP:
+		return "tcp", nil
+	case *CheckExec:
+		return "exec", nil
+	case *CheckLog:
+		return "log", nil
+	case CheckConnections:
+		return "connections", nil
+	case CheckListen:
+		return "listen", nil
+	case CheckResources:
+		return "resources", nil
+	case *CheckVersion:
+		return "version", nil
+	case *CheckChanged:
+		return "changed", nil
+	default:
+		return "", fmt.Errorf("Unknown check type %T", check)
+	}
+}
+
+// prepare all checks implementing Preparer, with timeouts from their settings
+func (c Checks) Prepare(ctx context.Context, defaults CheckSettings) error {
+	for _, check := range c {
+		if p, ok := check.(Preparer); ok {
+			err := prepare(ctx, p, SettingsFor(check, defaults).Timeout.Duration())
+			if err != nil {
+				return fmt.Errorf("%s: %s", check.String(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func prepare(ctx context.Context, p Preparer, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return p.Prepare(ctx)
+}
+
 type check struct {
 	Type string `json:"type"`
 }
@@ -0,0 +1,96 @@
+package buddha
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// assert a value was changed by the command, such as a version or process
+// start time. the value is read before the command executes and must differ
+// afterwards or, if expect is set, equal the expected value.
+type CheckChanged struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// source of value to compare
+	Value Value `json:"value"`
+
+	// optional source of the expected value after the command
+	Expect *Value `json:"expect,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+
+	before, after string // values read by prepare and last execution
+	beforeErr     error  // error reading value before command
+}
+
+func (c *CheckChanged) Validate() error {
+	if err := c.Value.Validate(); err != nil {
+		return fmt.Errorf("value of changed check: %s", err)
+	}
+
+	if c.Expect != nil {
+		if err := c.Expect.Validate(); err != nil {
+			return fmt.Errorf("expected value of changed check: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// record the value before the command executes. a value which cannot be read,
+// for example because the process is not running, is not an error and any
+// value read afterwards will be deemed changed.
+func (c *CheckChanged) Prepare(ctx context.Context) error {
+	c.before, c.beforeErr = c.Value.Read(ctx)
+	c.after = ""
+
+	return nil
+}
+
+func (c *CheckChanged) Execute(timeout time.Duration) error {
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+func (c *CheckChanged) ExecuteContext(ctx context.Context) error {
+	var err error
+
+	c.after, err = c.Value.Read(ctx)
+	if err != nil {
+		return CheckFalse(fmt.Sprintf("could not read %s: %s", c.Value, err))
+	}
+
+	if c.Expect != nil {
+		expect, err := c.Expect.Read(ctx)
+		if err != nil {
+			return fmt.Errorf("could not read expected value from %s: %s", c.Expect, err)
+		}
+
+		if c.after != expect {
+			return CheckFalse(fmt.Sprintf("%s is %q, expected %q (was %q)", c.Value, c.after, expect, c.before))
+		}
+
+		return nil
+	}
+
+	if c.beforeErr == nil && c.after == c.before {
+		return CheckFalse(fmt.Sprintf("%s unchanged: %q", c.Value, c.after))
+	}
+
+	return nil
+}
+
+func (c *CheckChanged) Details() map[string]string {
+	before := c.before
+	if c.beforeErr != nil {
+		before = fmt.Sprintf("unavailable (%s)", c.beforeErr)
+	}
+
+	return map[string]string{"before": before, "after": c.after}
+}
+
+func (c *CheckChanged) String() string {
+	return c.Name
+}
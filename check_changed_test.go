@@ -0,0 +1,101 @@
+package buddha
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckChangedValidate(t *testing.T) {
+	c1 := &CheckChanged{}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := &CheckChanged{Value: Value{File: "/srv/app/REVISION"}, Expect: &Value{}}
+	if err := c2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c3 := &CheckChanged{Value: Value{File: "/srv/app/bin/app", Digest: "sha256"}}
+	if err := c3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckChangedExecute(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_changed")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	ioutil.WriteFile(file.Name(), []byte("abc123"), 0644)
+
+	c := &CheckChanged{Value: Value{File: file.Name()}}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("def456"), 0644)
+
+	if err := c.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if d := c.Details(); d["before"] != "abc123" || d["after"] != "def456" {
+		t.Fatal("unexpected details", d)
+	}
+}
+
+func TestCheckChangedExecuteExpect(t *testing.T) {
+	c := &CheckChanged{Value: Value{Command: []string{"echo", "1.1.0"}}, Expect: &Value{Literal: "1.2.0"}}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	c.Expect = &Value{Literal: "1.1.0"}
+	if err := c.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCheckChangedExecuteUnavailableBefore(t *testing.T) {
+	c := &CheckChanged{Value: Value{PidFile: "/nonexistent/app.pid"}}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// value still unavailable after command
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	// any readable value is deemed changed
+	c.Value = Value{Literal: "12345"}
+	if err := c.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCheckChangedString(t *testing.T) {
+	c := &CheckChanged{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
@@ -0,0 +1,70 @@
+package buddha
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// count tcp sockets on a local port, for waiting on connections to drain
+type CheckConnections struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// local port of sockets to count
+	Port int `json:"port"`
+
+	// socket state to count, default ESTABLISHED
+	State string `json:"state,omitempty"`
+
+	// maximum number of sockets tolerated for the check to pass
+	Max int `json:"max"`
+
+	// overrides of command health check settings
+	CheckSettings
+}
+
+func (c CheckConnections) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("expected port between 1 and 65535 for connections check")
+	}
+
+	if c.State != "" && !validTCPState(strings.ToUpper(c.State)) {
+		return fmt.Errorf("unknown tcp state %s for connections check", c.State)
+	}
+
+	if c.Max < 0 {
+		return fmt.Errorf("expected max of 0 or more for connections check")
+	}
+
+	return nil
+}
+
+func (c CheckConnections) Execute(timeout time.Duration) error {
+	state := strings.ToUpper(c.State)
+	if state == "" {
+		state = "ESTABLISHED"
+	}
+
+	sockets, err := readTCPSockets()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, socket := range sockets {
+		if socket.LocalPort == c.Port && socket.State == state {
+			count++
+		}
+	}
+
+	if count > c.Max {
+		return CheckFalse(fmt.Sprintf("%d %s connections on port %d, expected at most %d", count, state, c.Port, c.Max))
+	}
+
+	return nil
+}
+
+func (c CheckConnections) String() string {
+	return c.Name
+}
@@ -0,0 +1,56 @@
+package buddha
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckConnectionsValidate(t *testing.T) {
+	c1 := CheckConnections{}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := CheckConnections{Port: 8080, State: "FOO"}
+	if err := c2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c3 := CheckConnections{Port: 8080, State: "time_wait", Max: 10}
+	if err := c3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckConnectionsExecute(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"net/tcp":  testProcNetTCP,
+		"net/tcp6": testProcNetTCP6,
+	})
+	defer restore()
+
+	c1 := CheckConnections{Port: 8080, Max: 3}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckConnections{Port: 8080, Max: 2}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	c3 := CheckConnections{Port: 8080, State: "listen", Max: 1}
+	err = c3.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckConnectionsString(t *testing.T) {
+	c := CheckConnections{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
@@ -1,7 +1,9 @@
 package buddha
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"syscall"
@@ -17,6 +19,14 @@ type CheckExec struct {
 
 	// arguments to pass to executable
 	Args []string `json:"args"`
+
+	// capture stdout into a variable for later commands and checks of the job
+	Capture *Capture `json:"capture,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+
+	captured *string // value captured by the last execution
 }
 
 func (c CheckExec) Validate() error {
@@ -24,10 +34,20 @@ func (c CheckExec) Validate() error {
 		return fmt.Errorf("expected command to execute")
 	}
 
+	if c.Capture != nil {
+		return c.Capture.Validate()
+	}
+
 	return nil
 }
 
-func (c CheckExec) Execute(timeout time.Duration) error {
+func (c *CheckExec) Execute(timeout time.Duration) error {
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+func (c *CheckExec) ExecuteContext(ctx context.Context) error {
+	c.captured = nil
+
 	path, err := exec.LookPath(c.Path)
 	if err != nil {
 		return err
@@ -36,7 +56,29 @@ func (c CheckExec) Execute(timeout time.Duration) error {
 	fullArgs := []string{c.Path}
 	fullArgs = append(fullArgs, c.Args...)
 
-	p, err := os.StartProcess(path, fullArgs, &os.ProcAttr{})
+	attr := &os.ProcAttr{}
+	var stdout chan string
+	if c.Capture != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		attr.Files = []*os.File{nil, w, nil}
+
+		stdout = make(chan string, 1)
+		go func() {
+			p, _ := ioutil.ReadAll(r)
+			stdout <- string(p)
+		}()
+	}
+
+	p, err := os.StartProcess(path, fullArgs, attr)
+	if stdout != nil {
+		// closed once passed to the process, so the reader sees EOF on exit
+		attr.Files[1].Close()
+	}
 	if err != nil {
 		return err
 	}
@@ -69,12 +111,53 @@ func (c CheckExec) Execute(timeout time.Duration) error {
 
 	select {
 	case err := <-fail:
-		return err
+		if err != nil || stdout == nil {
+			return err
+		}
+
+		select {
+		case out := <-stdout:
+			return c.capture(out)
+		case <-ctx.Done():
+			return fmt.Errorf("timeout reading output to capture")
+		}
 
-	case <-time.After(timeout):
+	case <-ctx.Done():
 		p.Kill()
-		return fmt.Errorf("timeout exceeded")
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timeout exceeded")
+		}
+
+		return ctx.Err()
+	}
+}
+
+// record the value captured from stdout of a passing execution
+func (c *CheckExec) capture(stdout string) error {
+	value, err := c.Capture.Value(stdout)
+	if err != nil {
+		return err
+	}
+
+	c.captured = &value
+
+	return nil
+}
+
+func (c *CheckExec) CaptureVar() string {
+	if c.Capture == nil {
+		return ""
 	}
+
+	return c.Capture.Var
+}
+
+func (c *CheckExec) Captured() (string, bool) {
+	if c.captured == nil {
+		return "", false
+	}
+
+	return *c.captured, true
 }
 
 func (c CheckExec) String() string {
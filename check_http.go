@@ -1,6 +1,7 @@
 package buddha
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -20,6 +21,9 @@ type CheckHTTP struct {
 
 	// expected HTTP status codes
 	Expect []int `json:"expect,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
 }
 
 func (c CheckHTTP) Validate() error {
@@ -31,21 +35,25 @@ func (c CheckHTTP) Validate() error {
 }
 
 func (c CheckHTTP) Execute(timeout time.Duration) error {
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+func (c CheckHTTP) ExecuteContext(ctx context.Context) error {
 	if c.Method == "" {
 		c.Method = "OPTIONS"
 	}
 
-	client := &http.Client{
-		Timeout: timeout,
-	}
-
 	req, err := http.NewRequest(c.Method, c.Path, nil)
 	if err != nil {
 		return fmt.Errorf("building http request failed %s", err)
 	}
 
-	res, err := client.Do(req)
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return ctx.Err()
+		}
+
 		return CheckFalse(fmt.Sprintf("HTTP request failed: %s", err))
 	}
 	defer res.Body.Close()
@@ -0,0 +1,114 @@
+package buddha
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ensure a tcp port is listening, optionally held by a specific process
+type CheckListen struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// local port expected to be listening
+	Port int `json:"port"`
+
+	// path to pid file of process expected to own the socket
+	PidFile string `json:"pid_file,omitempty"`
+
+	// command name of process expected to own the socket
+	Process string `json:"process,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+}
+
+func (c CheckListen) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("expected port between 1 and 65535 for listen check")
+	}
+
+	return nil
+}
+
+func (c CheckListen) Execute(timeout time.Duration) error {
+	sockets, err := readTCPSockets()
+	if err != nil {
+		return err
+	}
+
+	listening := make(map[string]bool)
+	for _, socket := range sockets {
+		if socket.LocalPort == c.Port && socket.State == "LISTEN" {
+			listening[socket.Inode] = true
+		}
+	}
+
+	if len(listening) == 0 {
+		return CheckFalse(fmt.Sprintf("port %d is not listening", c.Port))
+	}
+
+	if c.PidFile != "" {
+		pid, err := readPidFile(c.PidFile)
+		if os.IsNotExist(err) {
+			return CheckFalse(fmt.Sprintf("pid file %s does not exist", c.PidFile))
+		} else if err != nil {
+			return err
+		}
+
+		owns, err := ownsSocket(pid, listening)
+		if err != nil {
+			return err
+		} else if !owns {
+			return CheckFalse(fmt.Sprintf("port %d is not held by pid %d from %s", c.Port, pid, c.PidFile))
+		}
+	}
+
+	if c.Process != "" {
+		pids, err := findProcesses(c.Process)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, pid := range pids {
+			owns, err := ownsSocket(pid, listening)
+			if err != nil {
+				return err
+			} else if owns {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return CheckFalse(fmt.Sprintf("port %d is not held by process %s", c.Port, c.Process))
+		}
+	}
+
+	return nil
+}
+
+func (c CheckListen) String() string {
+	return c.Name
+}
+
+// return true if process pid holds any of the socket inodes
+func ownsSocket(pid int, inodes map[string]bool) (bool, error) {
+	held, err := processSocketInodes(pid)
+	if os.IsNotExist(err) {
+		// process has exited
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for inode := range held {
+		if inodes[inode] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
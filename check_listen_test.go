@@ -0,0 +1,123 @@
+package buddha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fake proc filesystem with pid 100 (app) holding the listening socket on
+// port 8080 and pid 200 (stale) holding an established connection
+func fakeListenProc(t *testing.T) (string, func()) {
+	dir, restore := fakeProc(t, map[string]string{
+		"net/tcp":  testProcNetTCP,
+		"100/comm": "app\n",
+		"200/comm": "stale\n",
+	})
+
+	links := map[string]string{
+		"100/fd/0": "/dev/null",
+		"100/fd/3": "socket:[1001]",
+		"200/fd/3": "socket:[1002]",
+	}
+
+	for name, target := range links {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		err = os.Symlink(target, path)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	return dir, restore
+}
+
+func TestCheckListenValidate(t *testing.T) {
+	c1 := CheckListen{}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := CheckListen{Port: 8080, Process: "app"}
+	if err := c2.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckListenExecute(t *testing.T) {
+	_, restore := fakeListenProc(t)
+	defer restore()
+
+	c1 := CheckListen{Port: 8080}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckListen{Port: 8081}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckListenExecuteProcess(t *testing.T) {
+	_, restore := fakeListenProc(t)
+	defer restore()
+
+	c1 := CheckListen{Port: 8080, Process: "app"}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckListen{Port: 8080, Process: "stale"}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckListenExecutePidFile(t *testing.T) {
+	dir, restore := fakeListenProc(t)
+	defer restore()
+
+	pidFile := filepath.Join(dir, "app.pid")
+
+	c := CheckListen{Port: 8080, PidFile: pidFile}
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	if err := ioutil.WriteFile(pidFile, []byte("200\n"), 0644); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	if err := ioutil.WriteFile(pidFile, []byte("100\n"), 0644); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := c.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCheckListenString(t *testing.T) {
+	c := CheckListen{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
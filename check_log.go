@@ -0,0 +1,179 @@
+package buddha
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// watch a log file for a pattern written after command execution
+type CheckLog struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// path to log file
+	Path string `json:"path"`
+
+	// regular expression signalling success when matched
+	Match string `json:"match"`
+
+	// regular expression signalling failure when matched
+	Fail string `json:"fail,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+
+	offset  int64       // offset to begin reading from
+	file    os.FileInfo // file offset was recorded against
+	failed  error       // sticky final failure once fail pattern has been seen
+	matched bool        // match pattern has been seen since prepare
+	line    string      // last line matched by either pattern
+}
+
+func (c *CheckLog) Validate() error {
+	if len(c.Path) == 0 {
+		return fmt.Errorf("expected path to log file for log check")
+	}
+
+	if len(c.Match) == 0 {
+		return fmt.Errorf("expected match pattern for log check")
+	}
+
+	if _, err := regexp.Compile(c.Match); err != nil {
+		return fmt.Errorf("invalid match pattern for log check: %s", err)
+	}
+
+	if _, err := regexp.Compile(c.Fail); err != nil {
+		return fmt.Errorf("invalid fail pattern for log check: %s", err)
+	}
+
+	return nil
+}
+
+// record the current end of the log file, only lines written after this
+// offset will be considered by Execute
+func (c *CheckLog) Prepare(ctx context.Context) error {
+	c.offset = 0
+	c.file = nil
+	c.failed = nil
+	c.matched = false
+	c.line = ""
+
+	info, err := os.Stat(c.Path)
+	if os.IsNotExist(err) {
+		// file will be created by command
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.offset = info.Size()
+	c.file = info
+
+	return nil
+}
+
+func (c *CheckLog) Execute(timeout time.Duration) error {
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+// scan lines written since the previous execution for match or fail patterns.
+// matching the fail pattern is final, so the check is not retried. once
+// matched the check keeps passing, for example while soaking, unless the
+// fail pattern is later matched. if the file has been truncated or replaced
+// since the last read, scanning begins again from the start of the file.
+func (c *CheckLog) ExecuteContext(ctx context.Context) error {
+	if c.failed != nil {
+		return c.failed
+	}
+
+	match, err := regexp.Compile(c.Match)
+	if err != nil {
+		return err
+	}
+
+	var fail *regexp.Regexp
+	if c.Fail != "" {
+		fail, err = regexp.Compile(c.Fail)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(c.Path)
+	if os.IsNotExist(err) {
+		return CheckFalse(fmt.Sprintf("log file %s does not exist", c.Path))
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// logrotate either moves the file (new inode) or copies and truncates it
+	if (c.file != nil && !os.SameFile(c.file, info)) || info.Size() < c.offset {
+		c.offset = 0
+	}
+	c.file = info
+
+	_, err = file.Seek(c.offset, 0)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+
+	for ctx.Err() == nil {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// partial lines are left for the next execution
+			break
+		} else if err != nil {
+			return err
+		}
+
+		c.offset += int64(len(line))
+
+		if fail != nil && fail.MatchString(line) {
+			c.line = strings.TrimRight(line, "\r\n")
+			c.failed = CheckFalseFinal(fmt.Sprintf("log file %s matched fail pattern: %q", c.Path, c.line))
+			return c.failed
+		}
+
+		// lines after a match are still scanned for the fail pattern
+		if !c.matched && match.MatchString(line) {
+			c.line = strings.TrimRight(line, "\r\n")
+			c.matched = true
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+
+	if c.matched {
+		return nil
+	}
+
+	return CheckFalse(fmt.Sprintf("log file %s has not matched pattern %q", c.Path, c.Match))
+}
+
+func (c *CheckLog) Details() map[string]string {
+	if c.line == "" {
+		return nil
+	}
+
+	return map[string]string{"line": c.line}
+}
+
+func (c *CheckLog) String() string {
+	return c.Name
+}
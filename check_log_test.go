@@ -0,0 +1,176 @@
+package buddha
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, path, s string, flag int) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(s)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func tempLog(t *testing.T) string {
+	file, err := ioutil.TempFile("", "buddha_log")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	file.Close()
+
+	return file.Name()
+}
+
+func TestCheckLogValidate(t *testing.T) {
+	c1 := &CheckLog{Path: "/var/log/app.log"}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := &CheckLog{Path: "/var/log/app.log", Match: "("}
+	if err := c2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c3 := &CheckLog{Path: "/var/log/app.log", Match: "Listening", Fail: "FATAL"}
+	if err := c3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckLogExecute(t *testing.T) {
+	path := tempLog(t)
+	defer os.Remove(path)
+
+	writeLog(t, path, "Listening on port 8080\n", os.O_APPEND)
+
+	c := &CheckLog{Path: path, Match: "Listening on port"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// previous boot must not satisfy the check
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	writeLog(t, path, "booting\nListening on port 8080\n", os.O_APPEND)
+
+	err = c.Execute(1 * time.Second)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCheckLogExecuteFail(t *testing.T) {
+	path := tempLog(t)
+	defer os.Remove(path)
+
+	c := &CheckLog{Path: path, Match: "Listening", Fail: "FATAL"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	writeLog(t, path, "FATAL could not bind\nListening on port 8080\n", os.O_APPEND)
+
+	for i := 0; i < 2; i++ {
+		err := c.Execute(1 * time.Second)
+		if _, ok := err.(CheckFalseFinal); !ok {
+			t.Fatal("expected CheckFalseFinal, got", err)
+		}
+	}
+}
+
+func TestCheckLogExecuteFailAfterMatch(t *testing.T) {
+	path := tempLog(t)
+	defer os.Remove(path)
+
+	c := &CheckLog{Path: path, Match: "Listening", Fail: "FATAL"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// already written when the check first executes
+	writeLog(t, path, "Listening on port 8080\nFATAL out of memory\n", os.O_APPEND)
+
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalseFinal); !ok {
+		t.Fatal("expected CheckFalseFinal, got", err)
+	}
+}
+
+func TestCheckLogExecuteKeepsPassing(t *testing.T) {
+	path := tempLog(t)
+	defer os.Remove(path)
+
+	c := &CheckLog{Path: path, Match: "Listening", Fail: "FATAL"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	writeLog(t, path, "Listening on port 8080\n", os.O_APPEND)
+
+	// executed repeatedly while soaking
+	for i := 0; i < 2; i++ {
+		if err := c.Execute(1 * time.Second); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	writeLog(t, path, "FATAL out of memory\n", os.O_APPEND)
+
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalseFinal); !ok {
+		t.Fatal("expected CheckFalseFinal after fail pattern, got", err)
+	}
+}
+
+func TestCheckLogExecuteTruncated(t *testing.T) {
+	path := tempLog(t)
+	defer os.Remove(path)
+
+	writeLog(t, path, "a long line from the previous process\n", os.O_APPEND)
+
+	c := &CheckLog{Path: path, Match: "ready"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	writeLog(t, path, "ready\n", os.O_TRUNC)
+
+	err := c.Execute(1 * time.Second)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCheckLogExecuteMissing(t *testing.T) {
+	c := &CheckLog{Path: "/nonexistent/buddha.log", Match: "ready"}
+	if err := c.Prepare(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err := c.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckLogString(t *testing.T) {
+	c := &CheckLog{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
@@ -0,0 +1,107 @@
+package buddha
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// assert host resources are within thresholds, unset thresholds are ignored
+type CheckResources struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// path of filesystem for disk checks, default /
+	Path string `json:"path,omitempty"`
+
+	// minimum free disk space available to unprivileged users
+	MinDiskFree ByteSize `json:"min_disk_free,omitempty"`
+
+	// minimum free inodes
+	MinInodesFree uint64 `json:"min_inodes_free,omitempty"`
+
+	// minimum available memory as reported by /proc/meminfo
+	MinMemAvailable ByteSize `json:"min_mem_available,omitempty"`
+
+	// maximum 1, 5 and 15 minute load averages
+	MaxLoad1  float64 `json:"max_load1,omitempty"`
+	MaxLoad5  float64 `json:"max_load5,omitempty"`
+	MaxLoad15 float64 `json:"max_load15,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+}
+
+func (c CheckResources) Validate() error {
+	if c.MinDiskFree == 0 && c.MinInodesFree == 0 && c.MinMemAvailable == 0 &&
+		c.MaxLoad1 == 0 && c.MaxLoad5 == 0 && c.MaxLoad15 == 0 {
+		return fmt.Errorf("expected at least one threshold for resources check")
+	}
+
+	if c.MaxLoad1 < 0 || c.MaxLoad5 < 0 || c.MaxLoad15 < 0 {
+		return fmt.Errorf("expected positive load thresholds for resources check")
+	}
+
+	return nil
+}
+
+func (c CheckResources) Execute(timeout time.Duration) error {
+	var failures []string
+
+	if c.MinDiskFree > 0 || c.MinInodesFree > 0 {
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(path, &stat)
+		if err != nil {
+			return fmt.Errorf("could not stat filesystem %s: %s", path, err)
+		}
+
+		free := ByteSize(stat.Bavail * uint64(stat.Bsize))
+		if free < c.MinDiskFree {
+			failures = append(failures, fmt.Sprintf("%s free on %s, expected at least %s", free, path, c.MinDiskFree))
+		}
+
+		if stat.Ffree < c.MinInodesFree {
+			failures = append(failures, fmt.Sprintf("%d inodes free on %s, expected at least %d", stat.Ffree, path, c.MinInodesFree))
+		}
+	}
+
+	if c.MinMemAvailable > 0 {
+		available, err := readMemAvailable()
+		if err != nil {
+			return err
+		}
+
+		if available < c.MinMemAvailable {
+			failures = append(failures, fmt.Sprintf("%s memory available, expected at least %s", available, c.MinMemAvailable))
+		}
+	}
+
+	if c.MaxLoad1 > 0 || c.MaxLoad5 > 0 || c.MaxLoad15 > 0 {
+		load, err := readLoadAverage()
+		if err != nil {
+			return err
+		}
+
+		for i, max := range []float64{c.MaxLoad1, c.MaxLoad5, c.MaxLoad15} {
+			if max > 0 && load[i] > max {
+				failures = append(failures, fmt.Sprintf("%s minute load %.2f, expected at most %.2f", []string{"1", "5", "15"}[i], load[i], max))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return CheckFalse(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (c CheckResources) String() string {
+	return c.Name
+}
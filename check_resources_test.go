@@ -0,0 +1,94 @@
+package buddha
+
+import (
+	"testing"
+	"time"
+)
+
+var testProcMeminfo = `MemTotal:       16303744 kB
+MemFree:          512000 kB
+MemAvailable:    2097152 kB
+Buffers:          102400 kB
+`
+
+var testProcLoadavg = "0.50 1.25 2.00 1/123 4567\n"
+
+func TestCheckResourcesValidate(t *testing.T) {
+	c1 := CheckResources{}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := CheckResources{MaxLoad1: -1}
+	if err := c2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c3 := CheckResources{Path: "/var", MinDiskFree: Gigabyte}
+	if err := c3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckResourcesExecuteDisk(t *testing.T) {
+	c1 := CheckResources{Path: "/", MinDiskFree: 1, MinInodesFree: 0}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckResources{Path: "/", MinDiskFree: 1 << 62}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	c3 := CheckResources{Path: "/nonexistent", MinDiskFree: 1}
+	err = c3.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); ok || err == nil {
+		t.Fatal("expected error, got", err)
+	}
+}
+
+func TestCheckResourcesExecuteMemory(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"meminfo": testProcMeminfo,
+	})
+	defer restore()
+
+	c1 := CheckResources{MinMemAvailable: 2 * Gigabyte}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckResources{MinMemAvailable: 3 * Gigabyte}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckResourcesExecuteLoad(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"loadavg": testProcLoadavg,
+	})
+	defer restore()
+
+	c1 := CheckResources{MaxLoad1: 1, MaxLoad15: 4}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := CheckResources{MaxLoad5: 1}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckResourcesString(t *testing.T) {
+	c := CheckResources{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
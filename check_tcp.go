@@ -1,6 +1,7 @@
 package buddha
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -15,6 +16,9 @@ type CheckTCP struct {
 
 	// host:port of tcp server under test
 	Addr string `json:"addr"`
+
+	// overrides of command health check settings
+	CheckSettings
 }
 
 func (c CheckTCP) Validate() error {
@@ -26,8 +30,17 @@ func (c CheckTCP) Validate() error {
 }
 
 func (c CheckTCP) Execute(timeout time.Duration) error {
-	conn, err := net.DialTimeout("tcp", c.Addr, timeout)
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+func (c CheckTCP) ExecuteContext(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
 	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return ctx.Err()
+		}
+
 		log.Println(log.LevelInfo, "TCP connection failed: %s", err)
 		return CheckFalse(fmt.Sprintf("TCP connection failed: %s", err))
 	}
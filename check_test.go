@@ -1,8 +1,10 @@
 package buddha
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var testChecks = []byte(`[
@@ -25,3 +27,92 @@ func TestChecksUnmarshalJSON(t *testing.T) {
 		t.Fatal("expected checks[1] ws_8082", s)
 	}
 }
+
+func TestChecksUnmarshalJSONSettings(t *testing.T) {
+	var checks Checks
+	err := json.Unmarshal([]byte(`[
+  {"type": "tcp", "name": "ws_8082", "addr": "127.0.0.1:8082", "timeout": "5s", "failures": 10, "successes": 3}
+]`), &checks)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	settings := SettingsFor(checks[0], CheckSettings{Timeout: Duration(time.Second), Interval: Duration(2 * time.Second), Failures: 5})
+	if settings.Timeout != Duration(5*time.Second) {
+		t.Fatal("expected timeout 5s, got", settings.Timeout)
+	} else if settings.Interval != Duration(2*time.Second) {
+		t.Fatal("expected interval 2s, got", settings.Interval)
+	} else if settings.Failures != 10 {
+		t.Fatal("expected failures 10, got", settings.Failures)
+	} else if settings.Successes != 3 {
+		t.Fatal("expected successes 3, got", settings.Successes)
+	}
+}
+
+func TestChecksMarshalJSON(t *testing.T) {
+	var checks Checks
+	err := json.Unmarshal([]byte(`[
+  {"type": "tcp", "name": "ws_8082", "addr": "127.0.0.1:8082", "timeout": "5s"},
+  {"type": "log", "name": "booted", "path": "/var/log/app.log", "match": "ready"}
+]`), &checks)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	p, err := json.Marshal(checks)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var decoded Checks
+	err = json.Unmarshal(p, &decoded)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if tcp, ok := decoded[0].(CheckTCP); !ok || tcp.Timeout != Duration(5*time.Second) {
+		t.Fatal("expected tcp check with timeout 5s, got", decoded[0])
+	} else if _, ok := decoded[1].(*CheckLog); !ok {
+		t.Fatal("expected log check, got", decoded[1])
+	}
+}
+
+func TestCheckSettingsInherit(t *testing.T) {
+	s := CheckSettings{}.Inherit(CheckSettings{Failures: 5})
+
+	if s.Failures != 5 {
+		t.Fatal("expected failures 5, got", s.Failures)
+	} else if s.Successes != 1 {
+		t.Fatal("expected default successes 1, got", s.Successes)
+	}
+}
+
+type testSlowCheck struct{}
+
+func (testSlowCheck) String() string  { return "slow" }
+func (testSlowCheck) Validate() error { return nil }
+func (testSlowCheck) Execute(timeout time.Duration) error {
+	time.Sleep(1 * time.Second)
+	return nil
+}
+
+func TestExecuteCheckCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ExecuteCheck(ctx, testSlowCheck{}, 5*time.Second)
+	if err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
+
+func TestExecuteCheckContextCheck(t *testing.T) {
+	start := time.Now()
+
+	err := ExecuteCheck(context.Background(), &CheckExec{Path: "/bin/sleep", Args: []string{"1"}}, 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	} else if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatal("expected check to be interrupted, took", d)
+	}
+}
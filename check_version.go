@@ -0,0 +1,103 @@
+package buddha
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// necessity check comparing the running version with the desired version,
+// returning false (job unnecessary) when they already match
+type CheckVersion struct {
+	// name of check in logs
+	Name string `json:"name"`
+
+	// source of the currently running version
+	Running Value `json:"running"`
+
+	// source of the desired version
+	Desired Value `json:"desired"`
+
+	// comparison of versions, exact (default) or semver
+	Compare string `json:"compare,omitempty"`
+
+	// overrides of command health check settings
+	CheckSettings
+
+	running, desired string // versions read by last execution
+	runningErr       error  // error reading running version, if any
+}
+
+func (c *CheckVersion) Validate() error {
+	if err := c.Running.Validate(); err != nil {
+		return fmt.Errorf("running version of version check: %s", err)
+	}
+
+	if err := c.Desired.Validate(); err != nil {
+		return fmt.Errorf("desired version of version check: %s", err)
+	}
+
+	if c.Compare != "" && c.Compare != "exact" && c.Compare != "semver" {
+		return fmt.Errorf("unknown comparison %s for version check, expected exact or semver", c.Compare)
+	}
+
+	return nil
+}
+
+func (c *CheckVersion) Execute(timeout time.Duration) error {
+	return ExecuteCheck(context.Background(), c, timeout)
+}
+
+func (c *CheckVersion) ExecuteContext(ctx context.Context) error {
+	var err error
+
+	c.running, c.desired = "", ""
+	c.runningErr = nil
+
+	c.desired, err = c.Desired.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read desired version from %s: %s", c.Desired, err)
+	}
+
+	// a running version which cannot be read, for example because the app is
+	// down, makes the job necessary
+	c.running, err = c.Running.Read(ctx)
+	if err != nil {
+		c.runningErr = err
+		return nil
+	}
+
+	match := c.running == c.desired
+	if c.Compare == "semver" {
+		running, err := parseSemver(c.running)
+		if err != nil {
+			return err
+		}
+
+		desired, err := parseSemver(c.desired)
+		if err != nil {
+			return err
+		}
+
+		match = running.Compare(desired) == 0
+	}
+
+	if match {
+		return CheckFalse(fmt.Sprintf("running version %s matches desired version %s", c.running, c.desired))
+	}
+
+	return nil
+}
+
+func (c *CheckVersion) Details() map[string]string {
+	details := map[string]string{"running": c.running, "desired": c.desired}
+	if c.runningErr != nil {
+		details["running_error"] = c.runningErr.Error()
+	}
+
+	return details
+}
+
+func (c *CheckVersion) String() string {
+	return c.Name
+}
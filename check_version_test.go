@@ -0,0 +1,79 @@
+package buddha
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckVersionValidate(t *testing.T) {
+	c1 := &CheckVersion{Running: Value{Literal: "1.0.0"}}
+	if err := c1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c2 := &CheckVersion{Running: Value{Literal: "1.0.0"}, Desired: Value{Literal: "1.0.0"}, Compare: "fuzzy"}
+	if err := c2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c3 := &CheckVersion{Running: Value{Command: []string{"app", "--version"}}, Desired: Value{File: "/etc/app/version"}, Compare: "semver"}
+	if err := c3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestCheckVersionExecute(t *testing.T) {
+	c1 := &CheckVersion{Running: Value{Command: []string{"echo", "1.0.0"}}, Desired: Value{Literal: "1.0.0"}}
+	err := c1.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+
+	if d := c1.Details(); d["running"] != "1.0.0" || d["desired"] != "1.0.0" {
+		t.Fatal("unexpected details", d)
+	}
+
+	c2 := &CheckVersion{Running: Value{Command: []string{"echo", "1.0.0"}}, Desired: Value{Literal: "1.1.0"}}
+	if err := c2.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c3 := &CheckVersion{Running: Value{Command: []string{"echo", "1.0.0"}}, Desired: Value{Command: []string{"false"}}}
+	err = c3.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); ok || err == nil {
+		t.Fatal("expected error, got", err)
+	}
+}
+
+func TestCheckVersionExecuteRunningUnreadable(t *testing.T) {
+	// the app is down, so the job is necessary
+	c := &CheckVersion{Running: Value{Command: []string{"false"}}, Desired: Value{Literal: "1.1.0"}}
+	if err := c.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if d := c.Details(); d["running_error"] == "" {
+		t.Fatal("expected running error in details, got", d)
+	}
+}
+
+func TestCheckVersionExecuteSemver(t *testing.T) {
+	c1 := &CheckVersion{Running: Value{Literal: "v1.0.0+abc"}, Desired: Value{Literal: "1.0.0"}}
+	if err := c1.Execute(1 * time.Second); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c2 := &CheckVersion{Running: Value{Literal: "v1.0.0+abc"}, Desired: Value{Literal: "1.0.0"}, Compare: "semver"}
+	err := c2.Execute(1 * time.Second)
+	if _, ok := err.(CheckFalse); !ok {
+		t.Fatal("expected CheckFalse, got", err)
+	}
+}
+
+func TestCheckVersionString(t *testing.T) {
+	c := &CheckVersion{Name: "foo"}
+
+	if s := c.String(); s != "foo" {
+		t.Fatal("expected string foo, got", s)
+	}
+}
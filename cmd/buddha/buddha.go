@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pusher/buddha"
@@ -20,6 +27,88 @@ const (
 	ContinueBehaviour = "continue"
 	SkipBehaviour     = "skip"
 	StopBehaviour     = "stop"
+	RollbackBehaviour = "rollback"
+)
+
+// exit status of a run ended by a successful rollback
+const ExitRolledBack = 3
+
+// interval between invariant and soak checks when none is configured
+const DefaultPollInterval = 1 * time.Second
+
+// error returned when no rollback commands are defined
+var ErrNoRollback = errors.New("no rollback commands defined")
+
+// error returned by a job which completed with failed commands tolerated by
+// its max failures
+type ToleratedFailures struct {
+	Errs []error
+}
+
+func (e ToleratedFailures) Error() string {
+	return fmt.Sprintf("%d command failures tolerated, first: %s", len(e.Errs), e.Errs[0])
+}
+
+// error returned when a command, or a whole job, is skipped by its necessity
+// or before checks
+var ErrSkipped = errors.New("skipped")
+
+// error returned when before or after checks return false and the run is
+// to stop
+type ChecksFailed struct {
+	Kind string // before or after
+	Name string // run, job or command the checks belong to
+}
+
+func (e ChecksFailed) Error() string {
+	return fmt.Sprintf("%s checks of %s failed", e.Kind, e.Name)
+}
+
+// error returned when a job was rolled back
+type RollbackError struct {
+	Err         error // error causing the rollback
+	RollbackErr error // error from rollback commands, nil if successful
+}
+
+func (e RollbackError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("rollback failed: %s, after: %s", e.RollbackErr, e.Err)
+	}
+
+	return fmt.Sprintf("rolled back after: %s", e.Err)
+}
+
+// error returned when finally commands of a job fail
+type FinallyError struct {
+	Err        error // error from job, nil if job succeeded
+	FinallyErr error // first error from finally commands
+}
+
+func (e FinallyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s, finally failed: %s", e.Err, e.FinallyErr)
+	}
+
+	return fmt.Sprintf("finally failed: %s", e.FinallyErr)
+}
+
+// status of a job once a run has ended
+type jobStatus struct {
+	Name       string
+	Status     string
+	Err        error
+	FinallyErr error
+	Captured   map[string]string // variables captured by the job
+}
+
+// job statuses
+const (
+	StatusSucceeded      = "succeeded"
+	StatusSkipped        = "skipped"
+	StatusFailed         = "failed"
+	StatusRolledBack     = "rolled back"
+	StatusRollbackFailed = "rollback failed"
+	StatusNotRun         = "not run"
 )
 
 var (
@@ -27,6 +116,9 @@ var (
 	BuildRevision string = "development"
 )
 
+// unique identifier of this run, exposed to commands as BUDDHA_RUN_ID
+var RunID = newRunID()
+
 var (
 	ConfigDir     = flag.String("config-dir", "/etc/buddha.d", "")
 	ConfigFile    = flag.String("config", "", "")
@@ -35,9 +127,36 @@ var (
 	OnUnnecessary = flag.String("on-unnecessary", "skip", "")
 	OnBeforeFail  = flag.String("on-before-fail", "skip", "")
 	OnAfterFail   = flag.String("on-after-fail", "stop", "")
+	RunChecksFile = flag.String("run-checks", "", "")
+	DryRun        = flag.Bool("dry-run", false, "")
+	PrintConfig   = flag.Bool("print-config", false, "")
+	Sets          = make(setFlag)
 	ShowVersion   = flag.Bool("version", false, "")
 )
 
+// repeated --set key=value flags
+type setFlag map[string]string
+
+func (s setFlag) String() string {
+	pairs := make([]string, 0, len(s))
+	for key, value := range s {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (s setFlag) Set(pair string) error {
+	i := strings.Index(pair, "=")
+	if i < 1 {
+		return fmt.Errorf("expected key=value, got %s", pair)
+	}
+
+	s[pair[:i]] = pair[i+1:]
+	return nil
+}
+
 // --help usage page
 func Usage() {
 	fmt.Println(`usage: buddha [flags] <jobs...>
@@ -49,7 +168,11 @@ flags:
   --lock-path=/tmp/buddha.lock  path to lock file
   --on-unnecessary=skip         job behaviour if necessity checks deem it unnecessary (continue|skip)
   --on-before-fail=skip         job behaviour on before check failure (continue|skip|stop)
-  --on-after-fail=stop          run behaviour on after check failure (continue|stop)
+  --on-after-fail=stop          run behaviour on after check failure (continue|stop|rollback)
+  --run-checks=<file>           checks to execute before and after all jobs
+  --dry-run                     display commands and checks of jobs without executing them
+  --set key=value               set variable substituted as ${key}, may be repeated
+  --print-config                display job configuration with variables substituted
   --version                     display version information
 
 examples:
@@ -62,7 +185,9 @@ examples:
   to invoke demo.json file:
     $ buddha --config=demo.json all
   to invoke jobs from stdin:
-    $ cat demo.json | buddha --stdin all`)
+    $ cat demo.json | buddha --stdin all
+  to invoke server with variable port set to 8081:
+    $ buddha --set port=8081 server`)
 }
 
 // --version
@@ -73,6 +198,7 @@ func Version() {
 
 func init() {
 	flag.Usage = Usage
+	flag.Var(Sets, "set", "")
 	flag.Parse()
 
 	if *OnUnnecessary != ContinueBehaviour &&
@@ -89,7 +215,8 @@ func init() {
 	}
 
 	if *OnAfterFail != ContinueBehaviour &&
-		*OnAfterFail != StopBehaviour {
+		*OnAfterFail != StopBehaviour &&
+		*OnAfterFail != RollbackBehaviour {
 		fmt.Println(*OnAfterFail, " is not a valid value for --on-after-fail")
 		os.Exit(2)
 	}
@@ -132,12 +259,65 @@ func main() {
 		return
 	}
 
+	var runChecks *buddha.RunChecks
+	if *RunChecksFile != "" {
+		runChecks, err = buddha.OpenRunChecksFile(*RunChecksFile)
+		if err != nil {
+			log.Println(log.LevelFail, "fatal: could not read run checks file %s", *RunChecksFile)
+			log.Println(log.LevelFail, "fatal: %s", err)
+
+			os.Exit(2)
+			return
+		}
+	}
+
+	// abort run on interrupt
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Println(log.LevelFail, "received %s, aborting run", sig)
+		cancel()
+
+		// restore default behaviour so a second signal exits immediately,
+		// for example while finally commands are running
+		signal.Stop(signals)
+	}()
+
 	// exit with status code of run
-	os.Exit(run(jobs))
+	os.Exit(run(ctx, jobs, runChecks))
 
 }
 
-func run(jobs buddha.Jobs) int {
+func run(ctx context.Context, jobs buddha.Jobs, runChecks *buddha.RunChecks) int {
+	// sort jobs by name
+	sort.Sort(jobs)
+
+	jobsToRun := flag.Args()
+	if len(jobsToRun) == 0 {
+		log.Println(log.LevelFail, "please specify job names, or 'all' to run all")
+		return 2
+	}
+
+	jobs, err := selectJobs(jobs, jobsToRun, Sets)
+	if err != nil {
+		log.Println(log.LevelFail, "fatal: %s", err)
+		return 2
+	}
+
+	if runChecks == nil {
+		runChecks = new(buddha.RunChecks)
+	}
+
+	if *PrintConfig {
+		return printConfig(os.Stdout, jobs)
+	}
+
+	if *DryRun {
+		return dryRun(ctx, jobs, runChecks)
+	}
+
 	lock, err := flock.Lock(*LockPath)
 	if err != nil {
 		if err == flock.ErrLocked {
@@ -151,24 +331,34 @@ func run(jobs buddha.Jobs) int {
 	}
 	defer lock.Close()
 
-	// sort jobs by name
-	sort.Sort(jobs)
-
-	jobsToRun := flag.Args()
-	if len(jobsToRun) == 0 {
-		log.Println(log.LevelFail, "please specify job names, or 'all' to run all")
-		return 2
-	}
+	return runJobs(ctx, jobs, runChecks)
+}
 
-	// if not running all jobs, filter job list
-	if jobsToRun[0] != "all" {
+// return the jobs named, or all jobs if the first name is "all", with
+// variables substituted. only the jobs returned are resolved, so other jobs
+// need not have their variables defined.
+func selectJobs(jobs buddha.Jobs, names []string, sets map[string]string) (buddha.Jobs, error) {
+	if names[0] != "all" {
 		var missing []string
-		jobs, missing = jobs.Select(jobsToRun)
+		jobs, missing = jobs.Select(names)
 		if len(missing) > 0 {
 			log.Println(log.LevelInfo, "info: missing jobs %v", missing)
 		}
 	}
 
+	err := jobs.Resolve(sets)
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// run jobs in order, gated by run checks, logging a report of each job and
+// returning the exit status of the run
+func runJobs(ctx context.Context, jobs buddha.Jobs, runChecks *buddha.RunChecks) int {
+	log.Println(log.LevelInfo, "Run ID: %s", RunID)
+
 	// perform sanity checks against jobs
 	for i := 0; i < len(jobs); i++ {
 		if jobs[i].Root && (os.Getuid() != 0) {
@@ -178,217 +368,1088 @@ func run(jobs buddha.Jobs) int {
 	}
 
 	// execute jobs
+	report := make([]jobStatus, len(jobs))
 	for i := 0; i < len(jobs); i++ {
-		err := runJob(jobs[i])
-		if err != nil {
+		report[i] = jobStatus{Name: jobs[i].Name, Status: StatusNotRun}
+	}
+	defer logReport(report)
+
+	// preflight checks gating the whole run, which is not run if they fail
+	// unless --on-before-fail=continue
+	if len(runChecks.Before) > 0 {
+		log.Println(log.LevelPrim, "Run checks")
+
+		skip, err := executeBeforeChecks(ctx, "run", runChecks.Settings(), runChecks.Before)
+		if err != nil || skip {
+			log.Println(log.LevelFail, "fatal: run before checks failed, no jobs run")
+			return 1
+		}
+	}
+
+	// allow run after checks to record state before jobs change it
+	err := runChecks.After.Prepare(ctx, runChecks.Settings())
+	if err != nil {
+		log.Println(log.LevelFail, "fatal: could not prepare run after checks: %s", err)
+		return 1
+	}
+
+	for i := 0; i < len(jobs); i++ {
+		captured := buddha.NewCaptures(jobs[i])
+		err := runJob(withCaptures(ctx, captured), jobs[i])
+		report[i] = newJobStatus(jobs[i].Name, err)
+		report[i].Captured = captured.Values()
+
+		if e, ok := err.(FinallyError); ok {
+			if e.Err == nil || e.Err == ErrSkipped {
+				log.Println(log.LevelFail, "fatal: finally commands of job %s failed: %s", jobs[i].Name, e.FinallyErr)
+				return 1
+			}
+
+			err = e.Err
+		}
+
+		if ctx.Err() != nil {
+			log.Println(log.LevelFail, "fatal: run aborted during job %s", jobs[i].Name)
+			return 1
+		} else if e, ok := err.(RollbackError); ok {
+			if e.RollbackErr != nil {
+				return 1
+			}
+
+			return ExitRolledBack
+		} else if _, ok := err.(ChecksFailed); ok {
+			return 1
+		} else if _, ok := err.(ToleratedFailures); ok {
+			log.Println(log.LevelFail, "fatal: job %s failed: %s", jobs[i].Name, err)
+			return 1
+		} else if err != nil && err != ErrSkipped {
 			log.Println(log.LevelFail, "fatal: job %s failed with unexpected error: %s", jobs[i].Name, err)
 			return 1
 		}
 	}
 
+	if len(runChecks.After) > 0 {
+		log.Println(log.LevelPrim, "Run checks")
+
+		err := executeAfterChecks(ctx, "run", runChecks.Settings(), runChecks.After)
+		if err != nil {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// print configuration of jobs as json to w, with variables substituted
+func printConfig(w io.Writer, jobs buddha.Jobs) int {
+	p, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		log.Println(log.LevelFail, "fatal: could not encode config: %s", err)
+		return 1
+	}
+
+	fmt.Fprintln(w, string(p))
+	return 0
+}
+
+// log the checks and commands of each job, with command templates expanded,
+// without executing them
+func dryRun(ctx context.Context, jobs buddha.Jobs, runChecks *buddha.RunChecks) int {
+	logChecks("run before", runChecks.Before)
+
+	for _, job := range jobs {
+		log.Println(log.LevelPrim, "Job: %s", job.Name)
+
+		expanded, err := job.Expand(ctx)
+		if err != nil {
+			log.Println(log.LevelFail, "fatal: %s", err)
+			return 1
+		}
+
+		logChecks("job before", expanded.Before)
+		logChecks("invariant", expanded.Invariants)
+		logCommands("Command", expanded.Commands)
+		logChecks("job after", expanded.After)
+		logCommands("Rollback", expanded.Rollback)
+		logCommands("Finally", expanded.Finally)
+	}
+
+	logChecks("run after", runChecks.After)
+
 	return 0
 }
 
-func runJob(job *buddha.Job) error {
+// log commands and their checks for a dry run
+func logCommands(kind string, commands buddha.Commands) {
+	for _, cmd := range commands {
+		log.Println(log.LevelScnd, "%s: %s: %s %s", kind, cmd.Name, cmd.Path, strings.Join(cmd.Args, " "))
+		logChecks("necessity", cmd.Necessity)
+		logChecks("before", cmd.Before)
+		logChecks("after", cmd.After)
+		logCommands("Rollback of "+cmd.Name, cmd.Rollback)
+	}
+}
+
+// log checks for a dry run
+func logChecks(kind string, checks buddha.Checks) {
+	for _, check := range checks {
+		log.Println(log.LevelInfo, "%s check: %s", kind, check)
+	}
+}
+
+// return the status of a job from the error returned by runJob
+func newJobStatus(name string, err error) jobStatus {
+	if e, ok := err.(FinallyError); ok {
+		status := newJobStatus(name, e.Err)
+		status.FinallyErr = e.FinallyErr
+
+		if e.Err == nil || e.Err == ErrSkipped {
+			status.Status = StatusFailed
+		}
+
+		return status
+	}
+
+	if err == ErrSkipped {
+		return jobStatus{Name: name, Status: StatusSkipped}
+	}
+
+	status := jobStatus{Name: name, Status: StatusSucceeded, Err: err}
+
+	if e, ok := err.(RollbackError); ok {
+		status.Status = StatusRolledBack
+		if e.RollbackErr != nil {
+			status.Status = StatusRollbackFailed
+		}
+	} else if err != nil {
+		status.Status = StatusFailed
+	}
+
+	return status
+}
+
+// log the status of each job at the end of a run
+func logReport(report []jobStatus) {
+	log.Println(log.LevelPrim, "Report: run %s", RunID)
+
+	for _, job := range report {
+		if job.Err != nil {
+			log.Println(log.LevelInfo, "%s: %s (%s)", job.Name, job.Status, job.Err)
+		} else {
+			log.Println(log.LevelInfo, "%s: %s", job.Name, job.Status)
+		}
+
+		if job.FinallyErr != nil {
+			log.Println(log.LevelInfo, "%s: finally failed (%s)", job.Name, job.FinallyErr)
+		}
+
+		names := make([]string, 0, len(job.Captured))
+		for name := range job.Captured {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			log.Println(log.LevelInfo, "%s: captured %s=%q", job.Name, name, job.Captured[name])
+		}
+	}
+}
+
+func runJob(ctx context.Context, job *buddha.Job) (err error) {
 	log.Println(log.LevelPrim, "Job: %s", job.Name)
 
-	for _, cmd := range job.Commands {
-		log.Println(log.LevelPrim, "Command: %s", cmd.Name)
+	// values captured by commands and checks are substituted in later ones
+	if captures(ctx) == nil {
+		ctx = withCaptures(ctx, buddha.NewCaptures(job))
+	}
+
+	// finally commands run however the job ends, even if discovery fails,
+	// their failure is reported alongside any error from the job
+	defer func() {
+		if finallyErr := runFinally(ctx, job); finallyErr != nil {
+			err = FinallyError{Err: err, FinallyErr: finallyErr}
+		}
+	}()
+
+	// expand command templates of discovered items
+	expanded, err := job.Expand(ctx)
+	if err != nil {
+		log.Println(log.LevelFail, "fatal: %s", err)
+		return err
+	}
+	job = expanded
 
-		log.Println(log.LevelScnd, "Executing necessity checks")
-		isNecessaryResults, err := executeChecks(cmd, cmd.Necessity, executeNecessityCheck)
+	// job before checks gate the whole job
+	if len(job.Before) > 0 {
+		if err := substituteChecks(ctx, "before", job.Before); err != nil {
+			return err
+		}
+
+		skip, err := executeBeforeChecks(ctx, "job "+job.Name, job.Settings(), job.Before)
 		if err != nil {
-			log.Println(log.LevelFail, "fatal: unexpected error from necessity check, ending run")
 			return err
+		} else if skip {
+			return ErrSkipped
 		}
-		if allFalse(isNecessaryResults) {
-			switch *OnUnnecessary {
-			case ContinueBehaviour:
-				log.Println(log.LevelFail, "warning: job unnecessary, continuing anyway")
-			default:
-				log.Println(log.LevelInfo, "Job deemed unnecessary, skipping")
+	}
+
+	// allow job after checks to record state before commands change it
+	err = job.After.Prepare(ctx, job.Settings())
+	if err != nil {
+		log.Println(log.LevelFail, "fatal: could not prepare job after checks: %s", err)
+		return err
+	}
+
+	// invariants are polled while commands run, aborting the current command
+	// if one fails. they may refer to values captured by job before checks.
+	if err := substituteChecks(ctx, "invariant", job.Invariants); err != nil {
+		return err
+	}
+	invariants := watchInvariants(ctx, job)
+	defer invariants.Stop()
+
+	// commands are executed in batches of concurrency, no further batches
+	// are started once more than max failures commands have failed. a job
+	// with tolerated failures still fails once its commands have run.
+	concurrency := job.Concurrency.Of(len(job.Commands))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	maxFailures := job.MaxFailures.Of(len(job.Commands))
+
+	var tolerated []error
+	skipped := 0
+	for start := 0; start < len(job.Commands); start += concurrency {
+		end := start + concurrency
+		if end > len(job.Commands) {
+			end = len(job.Commands)
+		}
+
+		batch := job.Commands[start:end]
+		errs := runBatch(invariants.ctx, job, batch, concurrency > 1)
+		if failed := invariants.Failed(); failed != nil {
+			return invariantFailed(ctx, job, *failed)
+		}
+
+		for i, err := range errs {
+			if err == ErrSkipped {
+				skipped++
+				continue
+			} else if err == nil {
+				continue
+			}
+
+			cmd := batch[i]
+
+			// only after checks roll back, a command failing its before
+			// checks has not run. other failed checks are to stop the run.
+			if e, ok := err.(ChecksFailed); ok && e.Kind == "after" && *OnAfterFail == RollbackBehaviour {
+				commands := cmd.Rollback
+				if len(commands) == 0 {
+					commands = job.Rollback
+				}
+
+				err = rollback(ctx, job, commands, err)
+				if e := err.(RollbackError); e.RollbackErr != nil {
+					return err
+				}
+			} else if ok {
+				return err
+			}
+
+			if len(tolerated) < maxFailures && ctx.Err() == nil {
+				tolerated = append(tolerated, err)
+				log.Println(log.LevelFail, "warning: command %s failed, tolerating %d/%d failures", cmd.Name, len(tolerated), maxFailures)
 				continue
 			}
+
+			return err
 		}
+	}
 
-		// execute before health checks
-		// these will execute once and depending on --on-before-fail skip this job
-		log.Println(log.LevelScnd, "Executing before checks")
-		checksResults, err := executeChecks(cmd, cmd.Before, executeHealthCheck)
-		if err != nil {
-			log.Println(log.LevelFail, "fatal: unexpected error from before check, ending run")
+	if failed := invariants.Stop(); failed != nil {
+		return invariantFailed(ctx, job, *failed)
+	}
+
+	// job after checks validate the state once all commands have run
+	if len(job.After) > 0 {
+		if err := substituteChecks(ctx, "after", job.After); err != nil {
 			return err
 		}
-		if anyFalse(checksResults) {
-			switch *OnBeforeFail {
-			case StopBehaviour:
-				log.Println(log.LevelFail, "fatal: before returned false, ending run")
-				return nil
-			case ContinueBehaviour:
-				log.Println(log.LevelFail, "warning: before returned false, continuing anyway")
-			default:
-				log.Println(log.LevelFail, "warning: before returned false, skipping job")
-				continue
+
+		err := executeAfterChecks(ctx, "job "+job.Name, job.Settings(), job.After)
+		if e, ok := err.(ChecksFailed); ok && e.Kind == "after" && *OnAfterFail == RollbackBehaviour {
+			return rollback(ctx, job, job.Rollback, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(tolerated) > 0 {
+		return ToleratedFailures{Errs: tolerated}
+	}
+
+	// a job whose commands were all skipped did nothing
+	if len(job.Commands) > 0 && skipped == len(job.Commands) {
+		return ErrSkipped
+	}
+
+	return nil
+}
+
+// run commands of job at once, returning the error of each. when prefix is
+// true log lines of each command are prefixed with its name.
+func runBatch(ctx context.Context, job *buddha.Job, batch []buddha.Command, prefix bool) []error {
+	errs := make([]error, len(batch))
+
+	if !prefix {
+		for i, cmd := range batch {
+			errs[i] = runCommand(ctx, job, cmd)
+		}
+
+		return errs
+	}
+
+	wg := new(sync.WaitGroup)
+	for i, cmd := range batch {
+		wg.Add(1)
+
+		name := cmd.Name
+		if name == "" {
+			name = cmd.Path
+		}
+
+		cmdCtx := withLogger(ctx, logger(ctx).WithPrefix("["+name+"]"))
+		go func(i int, cmd buddha.Command) {
+			defer wg.Done()
+
+			errs[i] = runCommand(cmdCtx, job, cmd)
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// end job after invariant check failed, rolling back if configured
+func invariantFailed(ctx context.Context, job *buddha.Job, result buddha.CheckResult) error {
+	err := ChecksFailed{Kind: "invariant", Name: "job " + job.Name}
+
+	logFailedChecks(ctx, "invariant", buddha.CheckResults{result})
+	if *OnAfterFail == RollbackBehaviour {
+		log.Println(log.LevelFail, "fatal: invariant failed, rolling back")
+		return rollback(ctx, job, job.Rollback, err)
+	}
+
+	log.Println(log.LevelFail, "fatal: invariant failed, ending run")
+	return err
+}
+
+// background polling of the invariant checks of a job. unless
+// --on-after-fail=continue, ctx is cancelled when an invariant fails.
+type invariantWatch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	failed *buddha.CheckResult
+}
+
+// start polling invariants of job until ctx is done or Stop is called
+func watchInvariants(ctx context.Context, job *buddha.Job) *invariantWatch {
+	w := new(invariantWatch)
+	w.ctx, w.cancel = context.WithCancel(ctx)
+
+	for _, check := range job.Invariants {
+		w.wg.Add(1)
+
+		settings := buddha.SettingsFor(check, job.Settings())
+		go func(check buddha.Check) {
+			defer w.wg.Done()
+
+			w.watch(settings, check)
+		}(check)
+	}
+
+	return w
+}
+
+// poll check until ctx is done, or it fails past its failure budget and the
+// run is not to continue
+func (w *invariantWatch) watch(settings buddha.CheckSettings, check buddha.Check) {
+	interval := settings.Interval.Duration()
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	var since time.Time
+	failures := 0
+	for {
+		result := executeCheckAttempt(w.ctx, settings, check)
+		if w.ctx.Err() != nil {
+			return
+		}
+
+		wait := interval
+		if result.Outcome == buddha.OutcomePass {
+			captureChecks(w.ctx, buddha.Checks{check})
+
+			if failures > 0 {
+				log.Println(log.LevelInfo, "Invariant %s: recovered", check.String())
+			}
+			failures = 0
+		} else {
+			if failures == 0 {
+				since = time.Now()
+			}
+			failures++
+			result.Attempts = failures
+
+			log.Println(log.LevelFail, "warning: invariant %s: attempt %s: %s: %s", check.String(), attempt(failures, settings), result.Outcome, result.Message)
+
+			next, ok := settings.Retry(failures, time.Since(since))
+			if !ok || result.Final {
+				if *OnAfterFail == ContinueBehaviour {
+					log.Println(log.LevelFail, "warning: invariant %s failed, continuing anyway", check.String())
+					failures = 0
+				} else {
+					w.fail(result)
+					return
+				}
+			} else {
+				wait = next
 			}
 		}
 
-		// execute command
-		log.Println(log.LevelScnd, "Executing Command: %s %s", cmd.Path, strings.Join(cmd.Args, " "))
-		cmd.Stdout = execStdout
-		err = cmd.Execute()
-		if err != nil {
-			log.Println(log.LevelFail, "fatal: %s", err)
+		if err := sleep(w.ctx, wait); err != nil {
+			return
+		}
+	}
+}
+
+// record the first failed invariant and abort the current command
+func (w *invariantWatch) fail(result buddha.CheckResult) {
+	w.mu.Lock()
+	if w.failed == nil {
+		w.failed = &result
+	}
+	w.mu.Unlock()
+
+	w.cancel()
+}
+
+// return the failed invariant, or nil if none have failed
+func (w *invariantWatch) Failed() *buddha.CheckResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.failed
+}
+
+// stop polling invariants, returning the failed invariant if any
+func (w *invariantWatch) Stop() *buddha.CheckResult {
+	w.cancel()
+	w.wg.Wait()
+
+	return w.Failed()
+}
+
+// run every finally command of job, returning the first error. commands run
+// even if ctx is done, so are bounded only by their own exec timeouts.
+func runFinally(ctx context.Context, job *buddha.Job) error {
+	if len(job.Finally) == 0 {
+		return nil
+	}
+
+	log.Println(log.LevelPrim, "Finally: %s", job.Name)
+
+	// templates are left unexpanded if expanding the job failed
+	ctx = detach(ctx)
+	commands, err := job.Finally.Expand(ctx)
+	if err != nil {
+		log.Println(log.LevelFail, "warning: finally commands of job %s: %s", job.Name, err)
+		return err
+	}
+
+	var first error
+	for _, cmd := range commands {
+		err := runCommand(ctx, job, cmd)
+		if err != nil && err != ErrSkipped {
+			log.Println(log.LevelFail, "warning: finally command %s failed: %s", cmd.Name, err)
+
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
+// run rollback commands of job after it failed with err. a RollbackError is
+// returned recording whether rollback succeeded.
+func rollback(ctx context.Context, job *buddha.Job, commands []buddha.Command, err error) error {
+	if len(commands) == 0 {
+		log.Println(log.LevelFail, "fatal: no rollback defined for job %s", job.Name)
+		return RollbackError{Err: err, RollbackErr: ErrNoRollback}
+	}
+
+	log.Println(log.LevelPrim, "Rolling back job: %s", job.Name)
+
+	for _, rollbackCmd := range commands {
+		rollbackErr := runCommand(ctx, job, rollbackCmd)
+		if rollbackErr != nil && rollbackErr != ErrSkipped {
+			log.Println(log.LevelFail, "fatal: rollback of job %s failed", job.Name)
+			return RollbackError{Err: err, RollbackErr: rollbackErr}
+		}
+	}
+
+	log.Println(log.LevelPrim, "Rolled back job: %s", job.Name)
+	return RollbackError{Err: err}
+}
+
+// run a single command of job along with its checks. ErrSkipped is returned
+// if the command was skipped, and a nil error if its failure is to be ignored.
+func runCommand(ctx context.Context, job *buddha.Job, cmd buddha.Command) error {
+	logger(ctx).Println(log.LevelPrim, "Command: %s", cmd.Name)
+
+	if c := captures(ctx); c != nil {
+		if err := c.Substitute(&cmd); err != nil {
+			logger(ctx).Println(log.LevelFail, "fatal: command %s: %s", cmd.Name, err)
 			return err
 		}
+	}
 
-		// grace period between executing command and executing health checks/next command
-		log.Println(log.LevelInfo, "Waiting %s grace...", cmd.Grace)
-		time.Sleep(cmd.Grace.Duration())
+	logger(ctx).Println(log.LevelScnd, "Executing necessity checks")
+	isNecessaryResults, err := executeChecks(ctx, cmd.CheckSettings(), cmd.Necessity, executeNecessityCheck)
+	if err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: unexpected error from necessity check, ending run")
+		return err
+	}
+	if isNecessaryResults.AllFalse() {
+		switch *OnUnnecessary {
+		case ContinueBehaviour:
+			logger(ctx).Println(log.LevelFail, "warning: job unnecessary, continuing anyway")
+		default:
+			logger(ctx).Println(log.LevelInfo, "Job deemed unnecessary, skipping")
+			return ErrSkipped
+		}
+	}
 
-		// execute after health checks
-		log.Println(log.LevelScnd, "Executing after checks")
-		checksResults, err = executeChecks(cmd, cmd.After, executeHealthCheck)
+	// execute before health checks
+	// these will execute once and depending on --on-before-fail skip this command
+	skip, err := executeBeforeChecks(ctx, "command "+cmd.Name, cmd.CheckSettings(), cmd.Before)
+	if err != nil {
+		return err
+	} else if skip {
+		return ErrSkipped
+	}
+
+	// allow after checks to record state before the command changes it
+	err = cmd.After.Prepare(ctx, cmd.CheckSettings())
+	if err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: could not prepare after checks: %s", err)
+		return err
+	}
+
+	// execute command
+	logger(ctx).Println(log.LevelScnd, "Executing Command: %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	cmd.Stdout = execStdout(logger(ctx))
+	cmd.Stderr = execStderr(logger(ctx))
+	cmd.Environ = []string{
+		"BUDDHA_JOB=" + job.Name,
+		"BUDDHA_COMMAND=" + cmd.Name,
+		"BUDDHA_RUN_ID=" + RunID,
+	}
+	result, err := executeCommand(ctx, cmd)
+	if e, ok := err.(buddha.TimeoutError); ok {
+		logger(ctx).Println(log.LevelFail, "fatal: command %s exceeded exec timeout of %s", cmd.Name, e.Timeout)
+		logOutput(ctx, result)
+		return err
+	} else if err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: %s", err)
+		logOutput(ctx, result)
+		return err
+	}
+
+	if cmd.Capture != nil {
+		value, err := cmd.Capture.Value(result.Stdout)
 		if err != nil {
-			log.Println(log.LevelFail, "fatal: unexpected error from after check, ending run. err: %s", err)
+			logger(ctx).Println(log.LevelFail, "fatal: %s", err)
+			logOutput(ctx, result)
+			return err
+		}
+
+		capture(ctx, cmd.Capture.Var, value)
+	}
+
+	// grace period between executing command and executing health checks/next command
+	logger(ctx).Println(log.LevelInfo, "Waiting %s grace...", cmd.Grace)
+	err = sleep(ctx, cmd.Grace.Duration())
+	if err != nil {
+		return err
+	}
+
+	// execute after health checks
+	err = executeAfterChecks(ctx, "command "+cmd.Name, cmd.CheckSettings(), cmd.After)
+	if err != nil {
+		return err
+	}
+
+	// keep executing after health checks until soaked
+	return soak(ctx, "command "+cmd.Name, cmd.CheckSettings(), cmd.After, cmd.Soak.Duration())
+}
+
+// execute checks every interval for duration d once they have passed, any
+// failure is treated as an after check failure. a ChecksFailed error is
+// returned if the run is not to continue.
+func soak(ctx context.Context, name string, defaults buddha.CheckSettings, checks buddha.Checks, d time.Duration) error {
+	if d <= 0 || len(checks) == 0 {
+		return nil
+	}
+
+	interval := defaults.Interval.Duration()
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	logger(ctx).Println(log.LevelScnd, "Soaking for %s", d)
+	start := time.Now()
+	end := start.Add(d)
+	for {
+		remaining := end.Sub(time.Now())
+		if remaining <= 0 {
+			logger(ctx).Println(log.LevelInfo, "Soak complete")
+			return nil
+		}
+
+		if remaining < interval {
+			interval = remaining
+		}
+
+		if err := sleep(ctx, interval); err != nil {
 			return err
 		}
-		if anyFalse(checksResults) {
+
+		results, _ := executeChecks(ctx, defaults, checks, executeSoakCheck)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if results.AnyFalse() {
+			logFailedChecks(ctx, "soak", results)
+
 			if *OnAfterFail == ContinueBehaviour {
-				log.Println(log.LevelFail, "warning: after checks failed, continuing anyway")
+				logger(ctx).Println(log.LevelFail, "warning: checks failed during soak, continuing anyway")
 				continue
 			}
 
-			log.Println(log.LevelFail, "fatal: after checks failed, ending run")
-			return err
+			logger(ctx).Println(log.LevelFail, "fatal: checks failed during soak after %s", time.Since(start))
+			return ChecksFailed{Kind: "after", Name: name}
+		}
+	}
+}
+
+// execute before health checks of name, returning true if name is to be
+// skipped. a ChecksFailed error is returned if the run is to stop.
+func executeBeforeChecks(ctx context.Context, name string, defaults buddha.CheckSettings, checks buddha.Checks) (bool, error) {
+	logger(ctx).Println(log.LevelScnd, "Executing before checks")
+	checksResults, err := executeChecks(ctx, defaults, checks, executeHealthCheck)
+	if err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: unexpected error from before check, ending run")
+		return false, err
+	}
+	if checksResults.AnyFalse() {
+		logFailedChecks(ctx, "before", checksResults)
+
+		switch *OnBeforeFail {
+		case StopBehaviour:
+			logger(ctx).Println(log.LevelFail, "fatal: before returned false, ending run")
+			return false, ChecksFailed{Kind: "before", Name: name}
+		case ContinueBehaviour:
+			logger(ctx).Println(log.LevelFail, "warning: before returned false, continuing anyway")
+		default:
+			logger(ctx).Println(log.LevelFail, "warning: before returned false, skipping %s", name)
+			return true, nil
 		}
 	}
 
+	return false, nil
+}
+
+// execute after health checks of name. a ChecksFailed error is returned if
+// they return false and the run is not to continue.
+func executeAfterChecks(ctx context.Context, name string, defaults buddha.CheckSettings, checks buddha.Checks) error {
+	logger(ctx).Println(log.LevelScnd, "Executing after checks")
+	checksResults, err := executeChecks(ctx, defaults, checks, executeHealthCheck)
+	if err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: unexpected error from after check, ending run. err: %s", err)
+		return err
+	}
+	if checksResults.AnyFalse() {
+		logFailedChecks(ctx, "after", checksResults)
+
+		if *OnAfterFail == ContinueBehaviour {
+			logger(ctx).Println(log.LevelFail, "warning: after checks failed, continuing anyway")
+			return nil
+		}
+
+		if *OnAfterFail == StopBehaviour {
+			logger(ctx).Println(log.LevelFail, "fatal: after checks failed, ending run")
+		} else {
+			logger(ctx).Println(log.LevelFail, "fatal: after checks failed")
+		}
+		return ChecksFailed{Kind: "after", Name: name}
+	}
+
 	return nil
 }
 
+// execute command, retrying failed attempts as defined by the command. the
+// result of the last attempt is returned.
+func executeCommand(ctx context.Context, cmd buddha.Command) (*buddha.CommandResult, error) {
+	for i := 1; ; i++ {
+		result, err := cmd.Run(ctx)
+		if !cmd.ShouldRetry(err, i) || ctx.Err() != nil {
+			return result, err
+		}
+
+		logger(ctx).Println(log.LevelFail, "warning: attempt %d/%d of command %s failed: %s", i, cmd.Retries+1, cmd.Name, err)
+		logger(ctx).Println(log.LevelInfo, "Waiting %s before retrying...", cmd.RetryInterval)
+		if err := sleep(ctx, cmd.RetryInterval.Duration()); err != nil {
+			return result, err
+		}
+
+		logger(ctx).Println(log.LevelScnd, "Retrying Command: %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	}
+}
+
+type loggerKey struct{}
+
+// return ctx logging with l, for example to prefix lines of a command
+func withLogger(ctx context.Context, l *log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// return the logger of ctx, default log.DefaultLogger
+func logger(ctx context.Context) *log.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*log.Logger); ok {
+		return l
+	}
+
+	return log.DefaultLogger
+}
+
+type capturesKey struct{}
+
+// return ctx recording values captured by commands and checks in c
+func withCaptures(ctx context.Context, c *buddha.Captures) context.Context {
+	return context.WithValue(ctx, capturesKey{}, c)
+}
+
+// return the captures of ctx, nil if values are not to be captured
+func captures(ctx context.Context) *buddha.Captures {
+	c, _ := ctx.Value(capturesKey{}).(*buddha.Captures)
+	return c
+}
+
+// record a value captured by a command or check, logging it when changed
+func capture(ctx context.Context, name, value string) {
+	c := captures(ctx)
+	if c == nil {
+		return
+	}
+
+	if c.Set(name, value) {
+		logger(ctx).Println(log.LevelInfo, "Captured %s=%q", name, value)
+	}
+}
+
+// record values captured by the last execution of checks
+func captureChecks(ctx context.Context, checks buddha.Checks) {
+	for _, check := range checks {
+		if c, ok := check.(buddha.Capturer); ok {
+			if value, ok := c.Captured(); ok {
+				capture(ctx, c.CaptureVar(), value)
+			}
+		}
+	}
+}
+
+// substitute captured variables in job checks of kind before they execute
+func substituteChecks(ctx context.Context, kind string, checks buddha.Checks) error {
+	c := captures(ctx)
+	if c == nil || len(checks) == 0 {
+		return nil
+	}
+
+	if err := c.SubstituteChecks(checks); err != nil {
+		logger(ctx).Println(log.LevelFail, "fatal: job %s checks: %s", kind, err)
+		return err
+	}
+
+	return nil
+}
+
+// context carrying the values of a parent but not its cancellation
+type detachedContext struct {
+	context.Context
+}
+
+// return ctx without its deadline or cancellation, for commands which run
+// however the run ends
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// generate run identifier from the current time and random suffix
+func newRunID() string {
+	p := make([]byte, 4)
+	rand.Read(p)
+
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405"), p)
+}
+
 // pipe exec stdout to log
-func execStdout(line string) {
-	log.Println(log.LevelInfo, line)
+func execStdout(l *log.Logger) func(line string) {
+	return func(line string) {
+		l.Println(log.LevelInfo, "%s", line)
+	}
+}
+
+// pipe exec stderr to log
+func execStderr(l *log.Logger) func(line string) {
+	return func(line string) {
+		l.Println(log.LevelInfo, "stderr: %s", line)
+	}
+}
+
+// log the last lines of output from a failed command
+func logOutput(ctx context.Context, result *buddha.CommandResult) {
+	if result == nil || len(result.Output) == 0 {
+		return
+	}
+
+	logger(ctx).Println(log.LevelFail, "last %d lines of output (exit code %d):", len(result.Output), result.ExitCode)
+	for _, line := range result.Output {
+		logger(ctx).Println(log.LevelFail, "  %s", line)
+	}
 }
 
-// execute independent checks in worker goroutines
-func executeChecks(cmd buddha.Command, checks buddha.Checks, executeCheck ExecuteCheck) ([]bool, error) {
+// execute independent checks in worker goroutines, returning results in the
+// order of checks. an unexpected error from any check stops the remaining
+// checks from retrying, while ctx being done also interrupts checks in progress.
+func executeChecks(ctx context.Context, defaults buddha.CheckSettings, checks buddha.Checks, executeCheck ExecuteCheck) (buddha.CheckResults, error) {
 	if len(checks) == 0 {
 		return nil, nil
 	}
 
+	retry, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	wg := new(sync.WaitGroup)
-	done := make(chan bool, len(checks))
-	fail := make(chan error, 1)
+	results := make(buddha.CheckResults, len(checks))
+	fail := make(chan error, len(checks))
 
-	for _, check := range checks {
+	for i, check := range checks {
 		wg.Add(1)
 
-		go executeCheck(wg, cmd, check, done, fail)
+		settings := buddha.SettingsFor(check, defaults)
+		go func(i int, check buddha.Check) {
+			defer wg.Done()
+
+			results[i] = executeCheck(ctx, retry, settings, check)
+			if results[i].Outcome == buddha.OutcomeError {
+				fail <- results[i].Err
+				cancel()
+			}
+		}(i, check)
 	}
 	wg.Wait()
-	close(done)
+
+	captureChecks(ctx, checks)
 
 	select {
 	case err := <-fail:
-		return nil, err
+		return results, err
 	default:
-		results := make([]bool, len(checks))
-		i := 0
-		for result := range done {
-			results[i] = result
-			i++
-		}
 		return results, nil
 	}
 }
 
-type ExecuteCheck func(*sync.WaitGroup, buddha.Command, buddha.Check, chan bool, chan error)
+type ExecuteCheck func(ctx, retry context.Context, settings buddha.CheckSettings, check buddha.Check) buddha.CheckResult
 
-func executeNecessityCheck(wg *sync.WaitGroup, cmd buddha.Command, check buddha.Check, done chan bool, fail chan error) {
-	defer wg.Done()
+// execute check once, as any failure during soak fails the soak
+func executeSoakCheck(ctx, retry context.Context, settings buddha.CheckSettings, check buddha.Check) buddha.CheckResult {
+	result := executeCheckAttempt(ctx, settings, check)
+	result.Attempts = 1
 
-	for i := 1; true; i++ {
-		log.Println(log.LevelInfo, "Check %s: checking...", check.String())
-		err := check.Execute(cmd.Timeout.Duration())
-		if err != nil {
-			switch e := err.(type) {
-			case buddha.CheckFalse:
-				log.Println(log.LevelInfo, "Check %s: deemed job unnecessary: %s", check.String(), e)
-				done <- false
-				return
-			default:
-				// unexpected failure
-				log.Println(log.LevelInfo, "Check %d/%d: %s: returned error: %s", i, cmd.Failures, check.String(), e)
-				if i < cmd.Failures {
-					log.Println(log.LevelInfo, "Check %d/%d: %s: waiting %s...", i, cmd.Failures, check.String(), cmd.Interval)
-					time.Sleep(cmd.Interval.Duration())
-				} else {
-					fail <- err
-					return
-				}
-			}
-		} else {
-			log.Println(log.LevelInfo, "Check %s: deemed job necessary", check.String())
-			done <- true
-			return
+	return result
+}
+
+// execute a check once, timing its execution
+func executeCheckAttempt(ctx context.Context, settings buddha.CheckSettings, check buddha.Check) buddha.CheckResult {
+	start := time.Now()
+	err := buddha.ExecuteCheck(ctx, check, settings.Timeout.Duration())
+
+	return buddha.NewCheckResult(check, err, time.Since(start))
+}
+
+// return a result for check aborted by ctx after attempts
+func abortedResult(check buddha.Check, attempts int, err error) buddha.CheckResult {
+	result := buddha.NewCheckResult(check, err, 0)
+	result.Attempts = attempts
+
+	return result
+}
+
+func executeNecessityCheck(ctx, retry context.Context, settings buddha.CheckSettings, check buddha.Check) buddha.CheckResult {
+	start := time.Now()
+	for i := 1; ; i++ {
+		logger(ctx).Println(log.LevelInfo, "Check %s: checking...", check.String())
+		result := executeCheckAttempt(ctx, settings, check)
+		result.Attempts = i
+		logDetails(ctx, attempt(i, settings), result)
+
+		switch result.Outcome {
+		case buddha.OutcomePass:
+			logger(ctx).Println(log.LevelInfo, "Check %s: deemed job necessary", check.String())
+			return result
+
+		case buddha.OutcomeFalse:
+			logger(ctx).Println(log.LevelInfo, "Check %s: deemed job unnecessary: %s", check.String(), result.Message)
+			return result
+		}
+
+		if retry.Err() != nil {
+			return abortedResult(check, i, retry.Err())
+		}
+
+		// unexpected failure
+		logger(ctx).Println(log.LevelInfo, "Check %s: %s: returned error: %s", attempt(i, settings), check.String(), result.Message)
+		wait, ok := settings.Retry(i, time.Since(start))
+		if !ok {
+			return result
+		}
+
+		logger(ctx).Println(log.LevelInfo, "Check %s: %s: waiting %s...", attempt(i, settings), check.String(), wait)
+		if err := sleep(retry, wait); err != nil {
+			return abortedResult(check, i, err)
 		}
 	}
 }
 
-// execute a check synchronously as defined by check settings as part of a worker waitgroup
-func executeHealthCheck(wg *sync.WaitGroup, cmd buddha.Command, check buddha.Check, done chan bool, fail chan error) {
-	defer wg.Done()
+// execute a check synchronously as defined by check settings. the check passes
+// once it has succeeded settings.Successes times in a row, a false result or
+// error resets the run of successes and counts towards settings.Failures.
+// retrying ends early with an error result if retry is done.
+func executeHealthCheck(ctx, retry context.Context, settings buddha.CheckSettings, check buddha.Check) buddha.CheckResult {
+	start := time.Now()
+	successes := 0
+	attempts := 0
+	for i := 1; ; {
+		logger(ctx).Println(log.LevelInfo, "Check %s: %s: checking...", attempt(i, settings), check.String())
+		result := executeCheckAttempt(ctx, settings, check)
+		attempts++
+		result.Attempts = attempts
+		logDetails(ctx, attempt(i, settings), result)
 
-	for i := 1; true; i++ {
-		log.Println(log.LevelInfo, "Check %d/%d: %s: checking...", i, cmd.Failures, check.String())
-		err := check.Execute(cmd.Timeout.Duration())
-		if err != nil {
-			switch e := err.(type) {
-			case buddha.CheckFalse:
-				log.Println(log.LevelInfo, "Check %d/%d: %s: returned false: %s", i, cmd.Failures, check.String(), e)
-				if i < cmd.Failures {
-					log.Println(log.LevelInfo, "Check %d/%d: %s: waiting %s...", i, cmd.Failures, check.String(), cmd.Interval)
-					time.Sleep(cmd.Interval.Duration())
-				} else {
-					done <- false
-					return
-				}
-			default:
-				// unexpected failure
-				log.Println(log.LevelInfo, "Check %d/%d: %s: returned error: %s", i, cmd.Failures, check.String(), e)
-				if i < cmd.Failures {
-					log.Println(log.LevelInfo, "Check %d/%d: %s: waiting %s...", i, cmd.Failures, check.String(), cmd.Interval)
-					time.Sleep(cmd.Interval.Duration())
-				} else {
-					fail <- err
-					return
-				}
+		if result.Outcome == buddha.OutcomePass {
+			successes++
+			if successes >= settings.Successes {
+				logger(ctx).Println(log.LevelInfo, "Check %s: %s success!", attempt(i, settings), check.String())
+				return result
 			}
+
+			logger(ctx).Println(log.LevelInfo, "Check %s: %s: success %d/%d, waiting %s...", attempt(i, settings), check.String(), successes, settings.Successes, settings.Interval)
+			if err := sleep(retry, settings.Interval.Duration()); err != nil {
+				return abortedResult(check, attempts, err)
+			}
+			continue
+		}
+
+		successes = 0
+
+		if retry.Err() != nil {
+			return abortedResult(check, attempts, retry.Err())
+		}
+
+		if result.Outcome == buddha.OutcomeFalse {
+			logger(ctx).Println(log.LevelInfo, "Check %s: %s: returned false: %s", attempt(i, settings), check.String(), result.Message)
 		} else {
-			log.Println(log.LevelInfo, "Check %d/%d: %s success!", i, cmd.Failures, check.String())
-			done <- true
-			return
+			// unexpected failure
+			logger(ctx).Println(log.LevelInfo, "Check %s: %s: returned error: %s", attempt(i, settings), check.String(), result.Message)
 		}
+
+		if result.Final {
+			logger(ctx).Println(log.LevelInfo, "Check %s: %s: not retrying", attempt(i, settings), check.String())
+			return result
+		}
+
+		wait, ok := settings.Retry(i, time.Since(start))
+		if !ok {
+			return result
+		}
+
+		logger(ctx).Println(log.LevelInfo, "Check %s: %s: waiting %s...", attempt(i, settings), check.String(), wait)
+		if err := sleep(retry, wait); err != nil {
+			return abortedResult(check, attempts, err)
+		}
+
+		i++
 	}
 }
 
-func allFalse(arr []bool) bool {
-	if len(arr) == 0 {
-		return false
+// log details reported by a check attempt, in key order
+func logDetails(ctx context.Context, attempt string, result buddha.CheckResult) {
+	if len(result.Details) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(result.Details))
+	for key := range result.Details {
+		keys = append(keys, key)
 	}
-	aggregate := true
-	for _, v := range arr {
-		aggregate = aggregate && !v
+	sort.Strings(keys)
+
+	details := make([]string, len(keys))
+	for i, key := range keys {
+		details[i] = fmt.Sprintf("%s=%q", key, result.Details[key])
 	}
-	return aggregate
+
+	logger(ctx).Println(log.LevelInfo, "Check %s: %s: %s", attempt, result.Check, strings.Join(details, " "))
 }
 
-func anyFalse(arr []bool) bool {
-	for _, v := range arr {
-		if v == false {
-			return true
-		}
+// log checks which did not pass
+func logFailedChecks(ctx context.Context, kind string, results buddha.CheckResults) {
+	for _, result := range results.Failed() {
+		logger(ctx).Println(log.LevelFail, "%s check %s: %s after %d attempt(s): %s", kind, result.Check, result.Outcome, result.Attempts, result.Message)
 	}
-	return false
+}
+
+// sleep for d, returning early with an error if ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// describe attempt i against the failure limit or deadline of settings
+func attempt(i int, settings buddha.CheckSettings) string {
+	if settings.Backoff != nil && settings.Backoff.Deadline > 0 {
+		return fmt.Sprintf("%d (deadline %s)", i, settings.Backoff.Deadline)
+	}
+
+	return fmt.Sprintf("%d/%d", i, settings.Failures)
 }
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -52,6 +58,26 @@ func (mockCheck *MockCheck) Execute(timeout time.Duration) error {
 	return result
 }
 
+// A check returning the same result however many times it is executed, for
+// checks polled in the background
+type ConstCheck struct {
+	Err           error
+	TimesExecuted int32
+}
+
+func (constCheck *ConstCheck) String() string {
+	return "constCheck"
+}
+
+func (constCheck *ConstCheck) Validate() error {
+	return errors.New("Did not expect Validate() to be called")
+}
+
+func (constCheck *ConstCheck) Execute(timeout time.Duration) error {
+	atomic.AddInt32(&constCheck.TimesExecuted, 1)
+	return constCheck.Err
+}
+
 type MockChecks []*MockCheck
 
 // Need to explicity cast a slice of concrete MockChecks to the Check interface
@@ -148,7 +174,7 @@ func testNecessityCheck(t *testing.T, returning [][]error, timesExecuted []int,
 	commands := []buddha.Command{command}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	for i, results := range returning {
 		assert.Equal(t, len(results), necessityMockChecks[i].TimesExecuted, "mismatch in necessityMockChecks")
@@ -174,7 +200,7 @@ func testBeforeCheck(t *testing.T, returning [][]error, timesExecuted []int, fai
 	commands := []buddha.Command{command}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	assert.Equal(t, 1, necessityMockChecks[0].TimesExecuted, "necessity check not executed")
 
@@ -200,7 +226,7 @@ func testAfterCheck(t *testing.T, returning [][]error, timesExecuted []int, fail
 	commands := []buddha.Command{command}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	assert.Equal(t, 1, necessityMockChecks[0].TimesExecuted, "necessity check not executed")
 	assert.Equal(t, 1, beforeMockChecks[0].TimesExecuted, "before check not executed")
@@ -431,7 +457,7 @@ func TestRunJobAfterChecksNotRunIfCommandFails(t *testing.T) {
 	commands := []buddha.Command{command}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	assert.Equal(t, 1, necessityMockChecks[0].TimesExecuted, "necessity check not executed")
 	assert.Equal(t, 1, beforeMockChecks[0].TimesExecuted, "before check not executed")
@@ -460,7 +486,7 @@ func TestRunJobMultipleCommands(t *testing.T) {
 	commands := []buddha.Command{command1, command2}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	assert.Equal(t, 1, necessityMockChecks1[0].TimesExecuted, "necessity check 1 not executed")
 	assert.Equal(t, 1, beforeMockChecks1[0].TimesExecuted, "before check 1 not executed")
@@ -493,7 +519,7 @@ func TestRunJobMultipleCommandsFirstErrors(t *testing.T) {
 	commands := []buddha.Command{command1, command2}
 	job := mkJob(commands)
 
-	runJob(job)
+	runJob(context.Background(), job)
 
 	assert.Equal(t, 1, necessityMockChecks1[0].TimesExecuted, "necessity check 1 not executed")
 	assert.Equal(t, 1, beforeMockChecks1[0].TimesExecuted, "before check 1 not executed")
@@ -503,3 +529,842 @@ func TestRunJobMultipleCommandsFirstErrors(t *testing.T) {
 	assert.Equal(t, 0, beforeMockChecks2[0].TimesExecuted, "before check 2 executed")
 	assert.Equal(t, 0, afterMockChecks2[0].TimesExecuted, "after check 2 executed")
 }
+
+// CONSECUTIVE SUCCESSES
+
+func TestRunJobAfterCheckSuccesses(t *testing.T) {
+	afterMockChecks := mkChecksReturning([]error{nil, buddha.CheckFalse("dummy false"), nil, nil})
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), DefaultFailures, true)
+	command.Successes = 2
+
+	runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, 4, afterMockChecks[0].TimesExecuted, "after check not executed until consecutive successes")
+}
+
+func TestRunJobAfterCheckSuccessesExhausted(t *testing.T) {
+	afterMockChecks := mkChecksReturning([]error{nil, buddha.CheckFalse("dummy false"), nil, buddha.CheckFalse("dummy false")})
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), DefaultFailures, true)
+	command.Successes = 2
+
+	runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, 4, afterMockChecks[0].TimesExecuted, "after check executed after failures exhausted")
+}
+
+// CANCELLATION
+
+func TestRunJobAfterCheckErrorCancelsOthers(t *testing.T) {
+	// the first check errors immediately, the second would retry forever
+	afterMockChecks := mkChecksReturning(
+		[]error{errors.New("error")},
+		[]error{buddha.CheckFalse("dummy false"), buddha.CheckFalse("dummy false")},
+	)
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+	command.Failures = 1
+	command.Backoff = &buddha.Backoff{Deadline: buddha.Duration(time.Hour)}
+	command.Interval = buddha.Duration(time.Hour)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runJob(context.Background(), mkJob([]buddha.Command{command}))
+	}()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, "error", err.Error(), "unexpected error from job")
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected failing check to cancel remaining checks")
+	}
+}
+
+func TestRunJobCancelled(t *testing.T) {
+	afterMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), DefaultFailures, true)
+	command.Grace = buddha.Duration(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := runJob(ctx, mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, context.Canceled, err, "expected job to be cancelled")
+	assert.Equal(t, 0, afterMockChecks[0].TimesExecuted, "after check executed")
+}
+
+// CHECK RESULTS
+
+func TestExecuteChecksResultsInOrder(t *testing.T) {
+	mockChecks := mkChecksReturning(
+		[]error{buddha.CheckFalse("dummy false"), buddha.CheckFalse("dummy false")},
+		[]error{buddha.CheckFalse("dummy false"), nil},
+		[]error{nil},
+	)
+	for i, c := range mockChecks {
+		c.Str = fmt.Sprintf("check%d", i)
+	}
+	command := mkCommand(nil, nil, nil, DefaultFailures, true)
+
+	results, err := executeChecks(context.Background(), command.CheckSettings(), mockChecks.toChecks(), executeHealthCheck)
+
+	assert.Equal(t, nil, err, "unexpected error")
+	assert.Equal(t, 3, len(results), "expected a result per check")
+	assert.Equal(t, "check0", results[0].Check, "results out of order")
+	assert.Equal(t, buddha.OutcomeFalse, results[0].Outcome, "expected check0 false")
+	assert.Equal(t, "dummy false", results[0].Message, "expected check0 message")
+	assert.Equal(t, 2, results[0].Attempts, "expected check0 attempts")
+	assert.Equal(t, "check1", results[1].Check, "results out of order")
+	assert.Equal(t, buddha.OutcomePass, results[1].Outcome, "expected check1 pass")
+	assert.Equal(t, 2, results[1].Attempts, "expected check1 attempts")
+	assert.Equal(t, "check2", results[2].Check, "results out of order")
+	assert.Equal(t, 1, results[2].Attempts, "expected check2 attempts")
+}
+
+// COMMAND RETRIES
+
+func TestExecuteCommandRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buddha_retries")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// fail until the third attempt
+	command := buddha.Command{
+		Path:          "sh",
+		Args:          []string{"-c", "echo >> attempts; test $(wc -l < attempts) -ge 3"},
+		Dir:           dir,
+		Retries:       3,
+		RetryInterval: DefaultDuration,
+	}
+
+	_, err = executeCommand(context.Background(), command)
+	assert.Equal(t, nil, err, "unexpected error")
+
+	p, _ := ioutil.ReadFile(filepath.Join(dir, "attempts"))
+	assert.Equal(t, 3, len(p), "expected 3 attempts")
+}
+
+func TestExecuteCommandRetriesExhausted(t *testing.T) {
+	command := buddha.Command{Path: "false", Retries: 2, RetryInterval: DefaultDuration}
+
+	result, err := executeCommand(context.Background(), command)
+	code, _ := buddha.ExitCode(err)
+	assert.Equal(t, 1, code, "expected exit code 1")
+	assert.Equal(t, 1, result.ExitCode, "expected result exit code 1")
+}
+
+// ROLLBACK
+
+func withOnAfterFail(behaviour string) func() {
+	previous := *OnAfterFail
+	*OnAfterFail = behaviour
+
+	return func() { *OnAfterFail = previous }
+}
+
+func TestRunJobAfterCheckFalseStops(t *testing.T) {
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	_, ok := err.(ChecksFailed)
+	assert.True(t, ok, "expected ChecksFailed")
+}
+
+func TestRunJobRollback(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	e, ok := err.(RollbackError)
+	assert.True(t, ok, "expected RollbackError")
+	assert.Nil(t, e.RollbackErr, "expected rollback to succeed")
+	assert.Equal(t, 1, rollbackMockChecks[0].TimesExecuted, "rollback after check not executed")
+	assert.Equal(t, StatusRolledBack, newJobStatus("mock job", err).Status, "unexpected job status")
+}
+
+func TestRunJobRollbackJob(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+
+	// failing rollback command from job
+	job := mkJob([]buddha.Command{command})
+	job.Rollback = []buddha.Command{mkCommand(nil, nil, nil, 1, false)}
+
+	err := runJob(context.Background(), job)
+
+	e, ok := err.(RollbackError)
+	assert.True(t, ok, "expected RollbackError")
+	assert.NotNil(t, e.RollbackErr, "expected rollback to fail")
+	assert.Equal(t, StatusRollbackFailed, newJobStatus("mock job", err).Status, "unexpected job status")
+}
+
+func TestRunJobRollbackUndefined(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	e, ok := err.(RollbackError)
+	assert.True(t, ok, "expected RollbackError")
+	assert.Equal(t, ErrNoRollback, e.RollbackErr, "expected no rollback error")
+}
+
+func TestRunJobRollbackNotOnCommandFailure(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, nil, 1, false)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	_, ok := err.(RollbackError)
+	assert.False(t, ok, "expected command failure not to roll back")
+	assert.Equal(t, 0, rollbackMockChecks[0].TimesExecuted, "rollback executed")
+}
+
+// FINALLY
+
+func TestRunJobFinallyAfterFailure(t *testing.T) {
+	finallyMockChecks := mkChecksReturningOnce(nil)
+	job := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, false)})
+	job.Finally = []buddha.Command{mkCommand(nil, nil, finallyMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), job)
+
+	code, _ := buddha.ExitCode(err)
+	assert.Equal(t, 1, code, "expected original error")
+	assert.Equal(t, 1, finallyMockChecks[0].TimesExecuted, "finally command not executed")
+}
+
+func TestRunJobFinallyCancelled(t *testing.T) {
+	finallyMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, nil, 1, true)
+	command.Grace = buddha.Duration(time.Hour)
+	job := mkJob([]buddha.Command{command})
+	job.Finally = []buddha.Command{mkCommand(nil, nil, finallyMockChecks.toChecks(), 1, true)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := runJob(ctx, job)
+
+	assert.Equal(t, context.Canceled, err, "expected job to be cancelled")
+	assert.Equal(t, 1, finallyMockChecks[0].TimesExecuted, "finally command not executed")
+}
+
+func TestRunJobFinallyDiscoveryFails(t *testing.T) {
+	finallyMockChecks := mkChecksReturningOnce(nil)
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "app_${item}", "discover": {"command": ["true"]}, "require_items": true, "path": "true"}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	jobs[0].Finally = []buddha.Command{mkCommand(nil, nil, finallyMockChecks.toChecks(), 1, true)}
+
+	err = runJob(context.Background(), jobs[0])
+
+	assert.NotNil(t, err, "expected discovery to fail")
+	assert.Equal(t, 1, finallyMockChecks[0].TimesExecuted, "finally command not executed")
+}
+
+func TestRunJobFinallyFails(t *testing.T) {
+	secondMockChecks := mkChecksReturningOnce(nil)
+	job := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, false)})
+	job.Finally = []buddha.Command{
+		mkCommand(nil, nil, nil, 1, false),
+		mkCommand(nil, nil, secondMockChecks.toChecks(), 1, true),
+	}
+
+	err := runJob(context.Background(), job)
+
+	e, ok := err.(FinallyError)
+	assert.True(t, ok, "expected FinallyError")
+	assert.NotNil(t, e.Err, "expected original error to be kept")
+	assert.NotNil(t, e.FinallyErr, "expected finally error")
+	assert.Equal(t, 1, secondMockChecks[0].TimesExecuted, "remaining finally command not executed")
+
+	status := newJobStatus("mock job", err)
+	assert.Equal(t, StatusFailed, status.Status, "unexpected job status")
+	assert.Equal(t, e.FinallyErr, status.FinallyErr, "expected finally error in report")
+}
+
+// JOB CHECKS
+
+func TestRunJobBeforeCheckFalseSkipsJob(t *testing.T) {
+	jobMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	beforeMockChecks := mkChecksReturningOnce(nil)
+	job := mkJob([]buddha.Command{mkCommand(nil, beforeMockChecks.toChecks(), nil, 1, true)})
+	job.Before = jobMockChecks.toChecks()
+	job.Failures = 1
+
+	err := runJob(context.Background(), job)
+
+	assert.Equal(t, ErrSkipped, err, "expected job to be skipped")
+	assert.Equal(t, StatusSkipped, newJobStatus("mock job", err).Status, "unexpected job status")
+	assert.Equal(t, 1, jobMockChecks[0].TimesExecuted, "job before check not executed")
+	assert.Equal(t, 0, beforeMockChecks[0].TimesExecuted, "command executed")
+}
+
+func TestRunJobAllUnnecessarySkipsJob(t *testing.T) {
+	necessityMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	job := mkJob([]buddha.Command{mkCommand(necessityMockChecks.toChecks(), nil, nil, 1, true)})
+
+	err := runJob(context.Background(), job)
+
+	assert.Equal(t, ErrSkipped, err, "expected job to be skipped")
+
+	err = FinallyError{Err: err, FinallyErr: errors.New("finally failed")}
+	assert.Equal(t, StatusFailed, newJobStatus("mock job", err).Status, "expected failing finally to fail skipped job")
+}
+
+func TestRunJobBeforeCheckFalseStops(t *testing.T) {
+	previous := *OnBeforeFail
+	*OnBeforeFail = StopBehaviour
+	defer func() { *OnBeforeFail = previous }()
+
+	beforeMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, beforeMockChecks.toChecks(), nil, 1, true)
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, ChecksFailed{Kind: "before", Name: "command succeeding command"}, err, "expected ChecksFailed")
+}
+
+func TestRunJobBeforeCheckFalseStopsWithoutRollback(t *testing.T) {
+	previous := *OnBeforeFail
+	*OnBeforeFail = StopBehaviour
+	defer func() { *OnBeforeFail = previous }()
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	beforeMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, beforeMockChecks.toChecks(), nil, 1, true)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, ChecksFailed{Kind: "before", Name: "command succeeding command"}, err, "expected ChecksFailed")
+	assert.Equal(t, 0, rollbackMockChecks[0].TimesExecuted, "rollback executed for command which did not run")
+}
+
+func TestRunJobAfterChecks(t *testing.T) {
+	afterMockChecks := mkChecksReturningOnce(nil)
+	jobMockChecks := mkChecksReturning([]error{buddha.CheckFalse("dummy false"), nil})
+	job := mkJob([]buddha.Command{
+		mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true),
+		mkCommand(nil, nil, nil, 1, true),
+	})
+	job.After = jobMockChecks.toChecks()
+	job.Failures = 2
+
+	err := runJob(context.Background(), job)
+
+	assert.Nil(t, err, "unexpected error")
+	assert.Equal(t, 1, afterMockChecks[0].TimesExecuted, "command after check not executed")
+	assert.Equal(t, 2, jobMockChecks[0].TimesExecuted, "job after check not executed once commands ran")
+}
+
+func TestRunJobAfterChecksRollback(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	jobMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	job := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, true)})
+	job.After = jobMockChecks.toChecks()
+	job.Failures = 1
+	job.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), job)
+
+	e, ok := err.(RollbackError)
+	assert.True(t, ok, "expected RollbackError")
+	assert.Equal(t, ChecksFailed{Kind: "after", Name: "job mock job"}, e.Err, "expected job after checks to fail")
+	assert.Equal(t, 1, rollbackMockChecks[0].TimesExecuted, "rollback not executed")
+}
+
+// INVARIANTS
+
+func mkInvariantJob(invariant buddha.Check, command buddha.Command) *buddha.Job {
+	job := mkJob([]buddha.Command{command})
+	job.Invariants = buddha.Checks{invariant}
+	job.Interval = DefaultDuration
+	job.Failures = DefaultFailures
+
+	return job
+}
+
+func TestRunJobInvariantPasses(t *testing.T) {
+	invariant := &ConstCheck{}
+	command := mkCommand(nil, nil, nil, 1, true)
+	command.Path = "sleep"
+	command.Args = []string{"0.1"}
+
+	err := runJob(context.Background(), mkInvariantJob(invariant, command))
+
+	assert.Nil(t, err, "unexpected error")
+	assert.True(t, atomic.LoadInt32(&invariant.TimesExecuted) > 0, "invariant not executed")
+}
+
+func TestRunJobInvariantFailsAbortsCommand(t *testing.T) {
+	afterMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+	command.Path = "sleep"
+	command.Args = []string{"60"}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runJob(context.Background(), mkInvariantJob(&ConstCheck{Err: buddha.CheckFalse("dummy false")}, command))
+	}()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, ChecksFailed{Kind: "invariant", Name: "job mock job"}, err, "expected invariant to fail")
+		assert.Equal(t, 0, afterMockChecks[0].TimesExecuted, "after check executed")
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected failing invariant to abort command")
+	}
+}
+
+func TestRunJobInvariantFailsRollback(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	command := mkCommand(nil, nil, nil, 1, true)
+	command.Path = "sleep"
+	command.Args = []string{"60"}
+
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	job := mkInvariantJob(&ConstCheck{Err: buddha.CheckFalse("dummy false")}, command)
+	job.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+
+	err := runJob(context.Background(), job)
+
+	e, ok := err.(RollbackError)
+	assert.True(t, ok, "expected RollbackError")
+	assert.Nil(t, e.RollbackErr, "expected rollback to succeed")
+	assert.Equal(t, 1, rollbackMockChecks[0].TimesExecuted, "rollback not executed")
+}
+
+// SOAK
+
+func TestRunJobSoak(t *testing.T) {
+	after := &ConstCheck{}
+	command := mkCommand(nil, nil, buddha.Checks{after}, 1, true)
+	command.Soak = buddha.Duration(50 * time.Millisecond)
+	command.Interval = buddha.Duration(10 * time.Millisecond)
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Nil(t, err, "unexpected error")
+	assert.True(t, atomic.LoadInt32(&after.TimesExecuted) >= 3, "after check not executed during soak")
+}
+
+func TestRunJobSoakFails(t *testing.T) {
+	afterMockChecks := mkChecksReturning([]error{nil, nil, buddha.CheckFalse("dummy false")})
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), DefaultFailures, true)
+	command.Soak = buddha.Duration(time.Hour)
+
+	err := runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Equal(t, ChecksFailed{Kind: "after", Name: "command succeeding command"}, err, "expected soak to fail")
+	assert.Equal(t, 3, afterMockChecks[0].TimesExecuted, "after check not executed until failure")
+}
+
+func TestRunJobSoakLogCheck(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_soak")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	command := mkCommand(nil, nil, buddha.Checks{&buddha.CheckLog{Name: "ready", Path: file.Name(), Match: "ready"}}, 1, true)
+	command.Path = "sh"
+	command.Args = []string{"-c", "echo ready >> " + file.Name()}
+	command.Timeout = buddha.Duration(time.Second)
+	command.Soak = buddha.Duration(50 * time.Millisecond)
+	command.Interval = buddha.Duration(10 * time.Millisecond)
+
+	err = runJob(context.Background(), mkJob([]buddha.Command{command}))
+
+	assert.Nil(t, err, "expected log check to keep passing during soak")
+}
+
+func TestExecuteHealthCheckFinal(t *testing.T) {
+	check := &ConstCheck{Err: buddha.CheckFalseFinal("dummy final")}
+	settings := buddha.CheckSettings{Failures: 5, Interval: buddha.Duration(time.Hour)}
+
+	result := executeHealthCheck(context.Background(), context.Background(), settings, check)
+
+	assert.Equal(t, buddha.OutcomeFalse, result.Outcome, "expected false outcome")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&check.TimesExecuted), "final check retried")
+}
+
+// CONCURRENCY
+
+func TestRunJobConcurrency(t *testing.T) {
+	var commands []buddha.Command
+	for _, name := range []string{"app_8081", "app_8082", "app_8083"} {
+		command := mkCommand(nil, nil, nil, 1, true)
+		command.Name = name
+		command.Path = "sleep"
+		command.Args = []string{"0.5"}
+		commands = append(commands, command)
+	}
+
+	job := mkJob(commands)
+	job.Concurrency = buddha.Amount{Percent: 100}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	start := time.Now()
+	err := runJob(context.Background(), job)
+
+	assert.Nil(t, err, "unexpected error")
+	assert.True(t, time.Since(start) < 1400*time.Millisecond, "expected commands to run at once")
+	assert.True(t, strings.Contains(buf.String(), "==> [app_8082] Command: app_8082"), "expected log lines prefixed with command")
+}
+
+func TestRunJobMaxFailures(t *testing.T) {
+	lastMockChecks := mkChecksReturningOnce(nil)
+	job := mkJob([]buddha.Command{
+		mkCommand(nil, nil, nil, 1, false),
+		mkCommand(nil, nil, nil, 1, false),
+		mkCommand(nil, nil, lastMockChecks.toChecks(), 1, true),
+	})
+	job.MaxFailures = buddha.Amount{N: 1}
+
+	err := runJob(context.Background(), job)
+
+	code, _ := buddha.ExitCode(err)
+	assert.Equal(t, 1, code, "expected second failure to end job")
+	assert.Equal(t, 0, lastMockChecks[0].TimesExecuted, "command executed after max failures exceeded")
+
+	job.MaxFailures = buddha.Amount{N: 2}
+
+	err = runJob(context.Background(), job)
+
+	e, ok := err.(ToleratedFailures)
+	assert.True(t, ok, "expected job with tolerated failures to fail")
+	assert.Equal(t, 2, len(e.Errs), "unexpected tolerated failures")
+	assert.Equal(t, StatusFailed, newJobStatus("mock job", err).Status, "unexpected job status")
+	assert.Equal(t, 1, lastMockChecks[0].TimesExecuted, "command not executed")
+}
+
+func TestRunJobMaxFailuresRollsBack(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	rollbackMockChecks := mkChecksReturningOnce(nil)
+	lastMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, mkChecksReturningOnce(buddha.CheckFalse("dummy false")).toChecks(), 1, true)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, rollbackMockChecks.toChecks(), 1, true)}
+	job := mkJob([]buddha.Command{command, mkCommand(nil, nil, lastMockChecks.toChecks(), 1, true)})
+	job.MaxFailures = buddha.Amount{N: 1}
+
+	err := runJob(context.Background(), job)
+
+	_, ok := err.(ToleratedFailures)
+	assert.True(t, ok, "expected job with tolerated failures to fail")
+	assert.Equal(t, 1, rollbackMockChecks[0].TimesExecuted, "tolerated command not rolled back")
+	assert.Equal(t, 1, lastMockChecks[0].TimesExecuted, "command not executed")
+}
+
+func TestRunJobMaxFailuresStop(t *testing.T) {
+	lastMockChecks := mkChecksReturningOnce(nil)
+	command := mkCommand(nil, nil, mkChecksReturningOnce(buddha.CheckFalse("dummy false")).toChecks(), 1, true)
+	job := mkJob([]buddha.Command{command, mkCommand(nil, nil, lastMockChecks.toChecks(), 1, true)})
+	job.MaxFailures = buddha.Amount{N: 1}
+
+	err := runJob(context.Background(), job)
+
+	assert.Equal(t, ChecksFailed{Kind: "after", Name: "command succeeding command"}, err, "expected stop not to be tolerated")
+	assert.Equal(t, 0, lastMockChecks[0].TimesExecuted, "command executed after stop")
+}
+
+// DISCOVERY
+
+func TestDryRun(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "workers", "commands": [
+		{"name": "worker_${item}", "discover": {"command": ["echo", "a\nb"]}, "path": "restart", "args": ["${item}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	code := dryRun(context.Background(), jobs, new(buddha.RunChecks))
+
+	assert.Equal(t, 0, code, "unexpected exit code")
+	assert.True(t, strings.Contains(buf.String(), "--> Command: worker_b: restart b"), "expected expanded command in output")
+}
+
+// CAPTURE
+
+func TestRunJobCapture(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "failures": 1, "commands": [
+		{"name": "version", "path": "sh", "args": ["-c", "echo app 1.2.3"], "failures": 1,
+		 "capture": {"var": "version", "match": "app (\\S+)"},
+		 "after": [{"type": "exec", "name": "pid", "path": "sh", "args": ["-c", "echo 42"], "capture": {"var": "pid"}}]},
+		{"name": "verify", "path": "sh", "args": ["-c", "test ${version} = 1.2.3 && test ${pid} = 42"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	captured := buddha.NewCaptures(jobs[0])
+	err = runJob(withCaptures(context.Background(), captured), jobs[0])
+
+	assert.Nil(t, err, "unexpected error")
+	values := captured.Values()
+	assert.Equal(t, "1.2.3", values["version"], "version not captured")
+	assert.Equal(t, "42", values["pid"], "pid not captured")
+}
+
+func TestRunJobCaptureJobChecks(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "failures": 1, "timeout": "1s", "interval": "10ms",
+		"before": [{"type": "exec", "name": "host", "path": "echo", "args": ["web1"], "capture": {"var": "host"}}],
+		"invariants": [{"type": "exec", "name": "lb", "path": "sh", "args": ["-c", "echo ${host}_lb"], "capture": {"var": "lb"}}],
+		"after": [{"type": "exec", "name": "pid", "path": "sh", "args": ["-c", "test '${pid}' = 42"]}],
+		"commands": [
+			{"name": "pid", "path": "sh", "args": ["-c", "sleep 0.1; echo 42"], "capture": {"var": "pid"}}
+		]
+	}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	captured := buddha.NewCaptures(jobs[0])
+	err = runJob(withCaptures(context.Background(), captured), jobs[0])
+
+	assert.Nil(t, err, "expected job checks to refer to captured values")
+	values := captured.Values()
+	assert.Equal(t, "web1", values["host"], "job before check value not captured")
+	assert.Equal(t, "web1_lb", values["lb"], "invariant value not captured")
+}
+
+func TestRunJobCaptureMissing(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "verify", "path": "true", "args": ["${version}"]},
+		{"name": "version", "path": "echo", "args": ["1.2.3"], "capture": {"var": "version"}}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = runJob(context.Background(), jobs[0])
+
+	assert.NotNil(t, err, "expected error referring to variable not captured yet")
+}
+
+// RUN
+
+func mkRunChecks(before, after buddha.Checks) *buddha.RunChecks {
+	return &buddha.RunChecks{
+		Before: before,
+		After:  after,
+		CheckSettings: buddha.CheckSettings{
+			Timeout:  DefaultDuration,
+			Interval: DefaultDuration,
+			Failures: 1,
+		},
+	}
+}
+
+func TestRunJobsSucceeds(t *testing.T) {
+	job := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, true)})
+
+	code := runJobs(context.Background(), buddha.Jobs{job}, new(buddha.RunChecks))
+
+	assert.Equal(t, 0, code, "unexpected exit code")
+}
+
+func TestRunJobsRolledBack(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, nil, 1, true)}
+
+	// jobs after one rolled back are not run
+	next := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, true)})
+	next.Name = "next job"
+	nextMockChecks := mkChecksReturningOnce(nil)
+	next.Before = nextMockChecks.toChecks()
+
+	code := runJobs(context.Background(), buddha.Jobs{mkJob([]buddha.Command{command}), next}, new(buddha.RunChecks))
+
+	assert.Equal(t, ExitRolledBack, code, "unexpected exit code")
+	assert.Equal(t, 0, nextMockChecks[0].TimesExecuted, "job run after rollback")
+}
+
+func TestRunJobsRollbackFailed(t *testing.T) {
+	defer withOnAfterFail(RollbackBehaviour)()
+
+	afterMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	command := mkCommand(nil, nil, afterMockChecks.toChecks(), 1, true)
+	command.Rollback = []buddha.Command{mkCommand(nil, nil, nil, 1, false)}
+
+	code := runJobs(context.Background(), buddha.Jobs{mkJob([]buddha.Command{command})}, new(buddha.RunChecks))
+
+	assert.Equal(t, 1, code, "unexpected exit code")
+}
+
+func TestRunJobsBeforeChecksFalse(t *testing.T) {
+	commandMockChecks := mkChecksReturning([]error{})
+	job := mkJob([]buddha.Command{mkCommand(nil, commandMockChecks.toChecks(), nil, 1, true)})
+
+	runMockChecks := mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	code := runJobs(context.Background(), buddha.Jobs{job}, mkRunChecks(runMockChecks.toChecks(), nil))
+
+	assert.Equal(t, 1, code, "unexpected exit code")
+	assert.Equal(t, 1, runMockChecks[0].TimesExecuted, "run before check not executed")
+	assert.Equal(t, 0, commandMockChecks[0].TimesExecuted, "job run after run before checks failed")
+}
+
+func TestRunJobsAfterChecks(t *testing.T) {
+	job := mkJob([]buddha.Command{mkCommand(nil, nil, nil, 1, true)})
+
+	runMockChecks := mkChecksReturningOnce(nil)
+	code := runJobs(context.Background(), buddha.Jobs{job}, mkRunChecks(nil, runMockChecks.toChecks()))
+
+	assert.Equal(t, 0, code, "unexpected exit code")
+	assert.Equal(t, 1, runMockChecks[0].TimesExecuted, "run after check not executed")
+
+	runMockChecks = mkChecksReturningOnce(buddha.CheckFalse("dummy false"))
+	code = runJobs(context.Background(), buddha.Jobs{job}, mkRunChecks(nil, runMockChecks.toChecks()))
+
+	assert.Equal(t, 1, code, "unexpected exit code")
+	assert.Equal(t, 1, runMockChecks[0].TimesExecuted, "run after check not executed")
+}
+
+func TestRunJobsReport(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[
+		{"name": "app", "commands": [
+			{"name": "version", "path": "sh", "args": ["-c", "echo app 1.2.3"], "failures": 1,
+			 "capture": {"var": "version", "match": "app (\\S+)"}}
+		]},
+		{"name": "cache", "before": [{"type": "exec", "name": "enabled", "path": "false"}], "commands": [
+			{"name": "clear", "path": "true"}
+		]},
+		{"name": "web", "commands": [{"name": "fail", "path": "false", "failures": 1}]},
+		{"name": "worker", "commands": [{"name": "restart", "path": "true"}]}
+	]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	code := runJobs(context.Background(), jobs, new(buddha.RunChecks))
+
+	assert.Equal(t, 1, code, "unexpected exit code")
+	report := buf.String()
+	report = report[strings.Index(report, "Report: run"):]
+	for _, line := range []string{
+		"app: succeeded",
+		`app: captured version="1.2.3"`,
+		"cache: skipped",
+		"web: failed",
+		"worker: not run",
+	} {
+		assert.True(t, strings.Contains(report, line), "expected report line "+line)
+	}
+}
+
+// VARIABLES
+
+func TestSetFlag(t *testing.T) {
+	sets := make(setFlag)
+
+	for _, pair := range []string{"port=8081", "url=http://a/?b=c", "empty="} {
+		assert.Nil(t, sets.Set(pair), "unexpected error for "+pair)
+	}
+
+	assert.Equal(t, "8081", sets["port"], "unexpected value")
+	assert.Equal(t, "http://a/?b=c", sets["url"], "expected value split on first =")
+	assert.Equal(t, "empty=,port=8081,url=http://a/?b=c", sets.String(), "unexpected string")
+
+	for _, pair := range []string{"port", "=8081", ""} {
+		assert.NotNil(t, sets.Set(pair), "expected error for "+pair)
+	}
+}
+
+func TestSelectJobs(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[
+		{"name": "app", "commands": [{"name": "restart", "path": "restart", "args": ["${port}"]}]},
+		{"name": "worker", "commands": [{"name": "restart", "path": "restart", "args": ["${queue}"]}]}
+	]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// worker does not need queue defined when not selected
+	selected, err := selectJobs(jobs, []string{"app", "missing"}, map[string]string{"port": "8081"})
+	assert.Nil(t, err, "unexpected error")
+	assert.Equal(t, 1, len(selected), "unexpected number of jobs")
+	assert.Equal(t, "8081", selected[0].Commands[0].Args[0], "variable not substituted")
+
+	_, err = selectJobs(jobs, []string{"all"}, map[string]string{"port": "8081"})
+	_, ok := err.(buddha.UndefinedVarsError)
+	assert.True(t, ok, "expected UndefinedVarsError")
+}
+
+func TestSelectJobsDuplicateNames(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "restart_${a}", "path": "restart"},
+		{"name": "restart_${b}", "path": "restart"}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err = selectJobs(jobs, []string{"app"}, map[string]string{"a": "web", "b": "web"})
+	assert.NotNil(t, err, "expected error for duplicate command names")
+}
+
+func TestPrintConfig(t *testing.T) {
+	jobs, err := buddha.Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "restart", "path": "restart", "args": ["${port}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	jobs, err = selectJobs(jobs, []string{"all"}, map[string]string{"port": "8081"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	buf := new(bytes.Buffer)
+	code := printConfig(buf, jobs)
+	assert.Equal(t, 0, code, "unexpected exit code")
+
+	// printed configuration may be loaded again
+	printed, err := buddha.Open(buf)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assert.Equal(t, 1, len(printed), "unexpected number of jobs")
+	assert.Equal(t, "8081", printed[0].Commands[0].Args[0], "expected variable substituted in config")
+}
@@ -1,9 +1,14 @@
 package buddha
 
 import (
-	"bufio"
-	"io"
+	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Command struct {
@@ -16,6 +21,53 @@ type Command struct {
 	// arguments to pass to executable
 	Args []string `json:"args,omitempty"`
 
+	// environment variables to set in addition to those of buddha
+	Env map[string]string `json:"env,omitempty"`
+
+	// path to file of KEY=VALUE lines to add to the environment
+	EnvFile string `json:"env_file,omitempty"`
+
+	// working directory of command, default is that of buddha
+	Dir string `json:"dir,omitempty"`
+
+	// user and group, by name or id, to execute command as
+	// group defaults to the primary group of user
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+
+	// maximum time for command execution, default unlimited
+	ExecTimeout Duration `json:"exec_timeout,omitempty"`
+
+	// signal sent to the command process group on timeout, default SIGTERM
+	KillSignal string `json:"kill_signal,omitempty"`
+
+	// time between the timeout signal and SIGKILL, default 10s
+	KillGrace Duration `json:"kill_grace,omitempty"`
+
+	// number of times to retry a failed command
+	Retries int `json:"retries,omitempty"`
+
+	// time between command retries
+	RetryInterval Duration `json:"retry_interval,omitempty"`
+
+	// exit codes to retry on, default is any non-zero exit code or timeout
+	RetryOnExitCodes []int `json:"retry_on_exit_codes,omitempty"`
+
+	// exit codes deemed successful in addition to 0
+	OkExitCodes []int `json:"ok_exit_codes,omitempty"`
+
+	// regular expressions failing the command if any line of output matches
+	FailIfOutputMatches []string `json:"fail_if_output_matches,omitempty"`
+
+	// regular expressions which must each match a line of output
+	RequireOutputMatches []string `json:"require_output_matches,omitempty"`
+
+	// number of lines of output kept for error reports, default 20
+	OutputLines int `json:"output_lines,omitempty"`
+
+	// capture stdout into a variable for later commands and checks of the job
+	Capture *Capture `json:"capture,omitempty"`
+
 	Necessity Checks `json:"necessity"`
 	Before    Checks `json:"before"`
 	After     Checks `json:"after"`
@@ -23,6 +75,10 @@ type Command struct {
 	// timeout between executing command and beginning health checking
 	Grace Duration `json:"grace"`
 
+	// time after checks keep being executed once they pass, any failure
+	// during which fails the after checks
+	Soak Duration `json:"soak,omitempty"`
+
 	// maximum time for check execution
 	Timeout Duration `json:"timeout"`
 
@@ -32,39 +88,269 @@ type Command struct {
 	// maximum health check failures before failing run
 	Failures int `json:"failures"`
 
-	Stdout func(line string) `json:"-"` // call func for each stdout line
+	// consecutive health check successes required, default 1
+	Successes int `json:"successes,omitempty"`
+
+	// backoff policy between health checks, default is a fixed interval
+	Backoff *Backoff `json:"backoff,omitempty"`
+
+	// commands to run if after checks fail with --on-after-fail=rollback
+	Rollback Commands `json:"rollback,omitempty"`
+
+	discovery *discovery // template expanded over discovered items at run time
+
+	Stdout  func(line string) `json:"-"` // call func for each stdout line
+	Stderr  func(line string) `json:"-"` // call func for each stderr line, default Stdout
+	Environ []string          `json:"-"` // KEY=VALUE environment set by the runner
+}
+
+// result of executing a command
+type CommandResult struct {
+	// exit code of command, -1 if it did not exit normally
+	ExitCode int
+
+	// time taken to execute command
+	Duration time.Duration
+
+	// last lines of output from stdout and stderr, oldest first
+	Output []OutputLine
+
+	// all of stdout when the command has a capture
+	Stdout string
+}
+
+// error returned when a command exceeds its exec timeout
+type TimeoutError struct {
+	Timeout Duration
+	Signal  syscall.Signal
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s, sent %s", e.Timeout, signalName(e.Signal))
+}
+
+// default health check settings for checks of this command
+func (c Command) CheckSettings() CheckSettings {
+	return CheckSettings{
+		Timeout:   c.Timeout,
+		Interval:  c.Interval,
+		Failures:  c.Failures,
+		Successes: c.Successes,
+		Backoff:   c.Backoff,
+	}
 }
 
 // execute system command, piping logs to reader
 func (c Command) Execute() error {
+	return c.ExecuteContext(context.Background())
+}
+
+// execute system command, killing it if ctx is done before it completes
+func (c Command) ExecuteContext(ctx context.Context) error {
+	_, err := c.Run(ctx)
+	return err
+}
+
+// execute system command, returning the result of the command once it has
+// exited and its output has been read. the result is nil if the command
+// could not be started. the command runs in its own process group which is
+// signalled if the command exceeds its exec timeout or ctx is done.
+func (c Command) Run(ctx context.Context) (*CommandResult, error) {
+	signal, err := c.killSignal()
+	if err != nil {
+		return nil, err
+	}
+
 	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	env, err := c.environ()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = env
+
+	if c.User != "" || c.Group != "" {
+		credential, home, err := lookupCredential(c.User, c.Group)
+		if err != nil {
+			return nil, err
+		}
 
-	stdout, err := cmd.StdoutPipe()
+		cmd.SysProcAttr.Credential = credential
+
+		if home != "" {
+			cmd.Env = setEnv(cmd.Env, "HOME", home)
+		}
+	}
+
+	out, err := newOutput(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer stdout.Close()
 
-	stderr, err := cmd.StderrPipe()
+	cmd.Stdout, err = out.Pipe(Stdout)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer stderr.Close()
 
-	// line readers for log data
-	if c.Stdout != nil {
-		go c.lineReader(stdout)
-		go c.lineReader(stderr)
+	cmd.Stderr, err = out.Pipe(Stderr)
+	if err != nil {
+		return nil, err
 	}
 
-	return cmd.Run()
+	start := time.Now()
+	err = cmd.Start()
+	out.CloseWriters()
+	if err != nil {
+		out.Wait(0)
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if c.ExecTimeout > 0 {
+		timer := time.NewTimer(c.ExecTimeout.Duration())
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err = <-done:
+		if code, ok := ExitCode(err); ok && inIntArray(c.OkExitCodes, code) {
+			err = nil
+		}
+
+	case <-timeout:
+		c.terminate(cmd.Process.Pid, signal, done)
+		err = TimeoutError{Timeout: c.ExecTimeout, Signal: signal}
+
+	case <-ctx.Done():
+		c.terminate(cmd.Process.Pid, signal, done)
+		err = ctx.Err()
+	}
+
+	out.Wait(outputWaitDelay)
+
+	result := &CommandResult{
+		ExitCode: -1,
+		Duration: time.Since(start),
+		Output:   out.Tail(),
+		Stdout:   out.Stdout(),
+	}
+
+	if cmd.ProcessState != nil {
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			result.ExitCode = status.ExitStatus()
+		}
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, out.Err()
+}
+
+// return true if a failed attempt returning err should be retried
+func (c Command) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt > c.Retries {
+		return false
+	}
+
+	if _, ok := err.(TimeoutError); ok {
+		return len(c.RetryOnExitCodes) == 0
+	}
+
+	code, ok := ExitCode(err)
+	if !ok {
+		// command could not be started or was interrupted
+		return false
+	}
+
+	return len(c.RetryOnExitCodes) == 0 || inIntArray(c.RetryOnExitCodes, code)
 }
 
-// execute stdout function for each line of output
-func (c Command) lineReader(r io.Reader) {
-	scanner := bufio.NewScanner(r)
+// return the exit code of a command from the error returned by executing it
+func ExitCode(err error) (int, bool) {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			return status.ExitStatus(), true
+		}
+	}
+
+	return 0, false
+}
+
+// signal process group pgid, escalating to SIGKILL if the leader has not
+// exited within the kill grace. remaining members of the group are killed
+// once the leader has exited.
+func (c Command) terminate(pgid int, signal syscall.Signal, done chan error) {
+	grace := c.KillGrace.Duration()
+	if grace == 0 {
+		grace = 10 * time.Second
+	}
+
+	syscall.Kill(-pgid, signal)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		<-done
+	}
+
+	// leftover children are reparented and reaped by init once killed
+	syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+func (c Command) killSignal() (syscall.Signal, error) {
+	if c.KillSignal == "" {
+		return syscall.SIGTERM, nil
+	}
+
+	return ParseSignal(c.KillSignal)
+}
+
+// build command environment from buddha environment, env_file, env and the
+// runner environment, each overriding the former
+func (c Command) environ() ([]string, error) {
+	env := os.Environ()
+
+	if c.EnvFile != "" {
+		vars, err := readEnvFile(c.EnvFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kv := range vars {
+			env = setEnv(env, kv[0], kv[1])
+		}
+	}
+
+	// sort keys for deterministic order
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	for scanner.Scan() {
-		c.Stdout(scanner.Text())
+	for _, key := range keys {
+		env = setEnv(env, key, c.Env[key])
 	}
+
+	for _, kv := range c.Environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env = setEnv(env, kv[:i], kv[i+1:])
+		}
+	}
+
+	return env, nil
 }
@@ -1,7 +1,14 @@
 package buddha
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommandExecute(t *testing.T) {
@@ -20,3 +27,292 @@ func TestCommandExecute(t *testing.T) {
 		t.Fatal("unexpected error:", err)
 	}
 }
+
+func TestCommandExecuteEnvironment(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_env")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("# app environment\nexport APP_ENV=staging\nAPP_PORT=\"8080\"\nAPP_NAME=ignored\n")
+	file.Close()
+
+	dir, err := ioutil.TempDir("", "buddha_dir")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := Command{
+		Path:    "sh",
+		Args:    []string{"-c", "echo $APP_ENV $APP_PORT $APP_NAME $BUDDHA_JOB > output"},
+		EnvFile: file.Name(),
+		Env:     map[string]string{"APP_NAME": "demo"},
+		Dir:     dir,
+		Environ: []string{"BUDDHA_JOB=my_job"},
+	}
+
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// output is written relative to working directory
+	p, err := ioutil.ReadFile(filepath.Join(dir, "output"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s := string(p); s != "staging 8080 demo my_job\n" {
+		t.Fatal("unexpected environment", s)
+	}
+}
+
+func TestCommandExecuteUnknownUser(t *testing.T) {
+	cmd := Command{Path: "true", User: "buddha-nonexistent-user"}
+
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestCommandExecuteTimeout(t *testing.T) {
+	cmd := Command{
+		Path:        "sleep",
+		Args:        []string{"5"},
+		ExecTimeout: Duration(100 * time.Millisecond),
+	}
+
+	start := time.Now()
+	err := cmd.Execute()
+	if _, ok := err.(TimeoutError); !ok {
+		t.Fatal("expected TimeoutError, got", err)
+	} else if d := time.Since(start); d > 2*time.Second {
+		t.Fatal("expected command to be terminated, took", d)
+	}
+}
+
+func TestCommandExecuteTimeoutKillGrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buddha_timeout")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ignore SIGTERM and leave a background child in the process group
+	cmd := Command{
+		Path:        "sh",
+		Args:        []string{"-c", `trap "" TERM; sleep 30 & echo $! > child.pid; sleep 30`},
+		Dir:         dir,
+		ExecTimeout: Duration(200 * time.Millisecond),
+		KillGrace:   Duration(200 * time.Millisecond),
+	}
+
+	start := time.Now()
+	err = cmd.Execute()
+	if _, ok := err.(TimeoutError); !ok {
+		t.Fatal("expected TimeoutError, got", err)
+	} else if d := time.Since(start); d > 5*time.Second {
+		t.Fatal("expected command to be killed, took", d)
+	}
+
+	pid, err := readPidFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// allow the child to be killed and reaped
+	time.Sleep(100 * time.Millisecond)
+
+	if processRunning(pid) {
+		t.Fatal("expected child process to be killed")
+	}
+}
+
+func TestCommandExecuteCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	cmd := Command{Path: "sleep", Args: []string{"5"}}
+
+	err := cmd.ExecuteContext(ctx)
+	if err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
+
+// return true if pid exists and is not a zombie
+func processRunning(pid int) bool {
+	p, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	s := string(p)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestCommandExecuteOkExitCodes(t *testing.T) {
+	cmd := Command{Path: "sh", Args: []string{"-c", "exit 3"}, OkExitCodes: []int{3}}
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	cmd.OkExitCodes = []int{4}
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestCommandShouldRetry(t *testing.T) {
+	exit1 := Command{Path: "false"}.Execute()
+	exit3 := Command{Path: "sh", Args: []string{"-c", "exit 3"}}.Execute()
+	notFound := Command{Path: "/nonexistent/command"}.Execute()
+	timeout := TimeoutError{}
+
+	c1 := Command{Retries: 2}
+	if !c1.ShouldRetry(exit1, 1) || !c1.ShouldRetry(exit1, 2) {
+		t.Fatal("expected retry of non-zero exit")
+	} else if c1.ShouldRetry(exit1, 3) {
+		t.Fatal("expected no retry after retries exhausted")
+	} else if c1.ShouldRetry(nil, 1) {
+		t.Fatal("expected no retry of success")
+	} else if c1.ShouldRetry(notFound, 1) {
+		t.Fatal("expected no retry of command not found")
+	} else if !c1.ShouldRetry(timeout, 1) {
+		t.Fatal("expected retry of timeout")
+	}
+
+	c2 := Command{Retries: 2, RetryOnExitCodes: []int{3}}
+	if c2.ShouldRetry(exit1, 1) {
+		t.Fatal("expected no retry of exit code 1")
+	} else if !c2.ShouldRetry(exit3, 1) {
+		t.Fatal("expected retry of exit code 3")
+	} else if c2.ShouldRetry(timeout, 1) {
+		t.Fatal("expected no retry of timeout")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	err := Command{Path: "sh", Args: []string{"-c", "exit 7"}}.Execute()
+
+	if code, ok := ExitCode(err); !ok || code != 7 {
+		t.Fatal("expected exit code 7, got", code, ok)
+	}
+
+	if _, ok := ExitCode(nil); ok {
+		t.Fatal("expected no exit code for nil error")
+	}
+}
+
+func TestCommandExecuteFailIfOutputMatches(t *testing.T) {
+	cmd := Command{
+		Path:                "sh",
+		Args:                []string{"-c", "echo starting; echo 'ERROR: watch not found' >&2"},
+		FailIfOutputMatches: []string{"^ERROR:"},
+	}
+
+	err := cmd.Execute()
+	if e, ok := err.(OutputError); !ok {
+		t.Fatal("expected OutputError, got", err)
+	} else if e.Line != "ERROR: watch not found" {
+		t.Fatal("expected offending line to be quoted, got", e.Line)
+	}
+
+	cmd.FailIfOutputMatches = []string{"^FATAL:"}
+	if err := cmd.Execute(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCommandExecuteRequireOutputMatches(t *testing.T) {
+	cmd := Command{
+		Path:                 "sh",
+		Args:                 []string{"-c", "echo 'Sending restart command'; echo 'app_8081: restarted'"},
+		RequireOutputMatches: []string{"restarted$", "^Sending"},
+	}
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	cmd.RequireOutputMatches = []string{"restarted$", "^started"}
+	err := cmd.Execute()
+	if e, ok := err.(OutputError); !ok {
+		t.Fatal("expected OutputError, got", err)
+	} else if e.Pattern != "^started" {
+		t.Fatal("expected missing pattern ^started, got", e.Pattern)
+	}
+}
+
+func TestCommandExecuteInvalidOutputPattern(t *testing.T) {
+	cmd := Command{Path: "true", FailIfOutputMatches: []string{"("}}
+
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestCommandRunOutput(t *testing.T) {
+	var stdout, stderr []string
+
+	cmd := Command{
+		Path:        "sh",
+		Args:        []string{"-c", "for i in 1 2 3 4; do echo out $i; done; echo err >&2; exit 3"},
+		OutputLines: 3,
+		Stdout:      func(line string) { stdout = append(stdout, line) },
+		Stderr:      func(line string) { stderr = append(stderr, line) },
+	}
+
+	result, err := cmd.Run(context.Background())
+	if code, _ := ExitCode(err); code != 3 {
+		t.Fatal("expected exit code 3, got", err)
+	}
+
+	if result.ExitCode != 3 {
+		t.Fatal("expected result exit code 3, got", result.ExitCode)
+	}
+
+	if len(stdout) != 4 || len(stderr) != 1 || stderr[0] != "err" {
+		t.Fatalf("expected 4 stdout and 1 stderr lines, got %q and %q", stdout, stderr)
+	}
+
+	// order of interleaved streams is not guaranteed, but within a stream it is
+	var tail []string
+	for _, line := range result.Output {
+		if line.Stream == Stdout {
+			tail = append(tail, line.Text)
+		}
+	}
+
+	if len(result.Output) != 3 || tail[len(tail)-1] != "out 4" {
+		t.Fatalf("expected last 3 lines of output, got %q", result.Output)
+	}
+}
+
+func TestCommandRunLongLine(t *testing.T) {
+	max := maxLineLength
+	maxLineLength = 10
+	defer func() { maxLineLength = max }()
+
+	cmd := Command{Path: "sh", Args: []string{"-c", "printf '%0100d\\nnext'"}}
+
+	result, err := cmd.Run(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(result.Output) != 2 {
+		t.Fatalf("expected 2 lines of output, got %q", result.Output)
+	}
+
+	if line := result.Output[0].Text; line != "0000000000 [truncated]" {
+		t.Fatal("expected truncated line, got", line)
+	}
+
+	if line := result.Output[1].Text; line != "next" {
+		t.Fatal("expected unterminated final line, got", line)
+	}
+}
@@ -1,6 +1,7 @@
 package buddha
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -16,6 +17,10 @@ func (d Duration) Duration() time.Duration {
 	return time.Duration(d)
 }
 
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
 func (d *Duration) UnmarshalJSON(p []byte) error {
 	if len(p) < 2 || p[0] != '"' || p[len(p)-1] != '"' {
 		return fmt.Errorf("invalid duration string: %s", string(p))
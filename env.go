@@ -0,0 +1,125 @@
+package buddha
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// read KEY=VALUE pairs from an environment file. blank lines and lines
+// beginning with # are ignored, as is a leading export. values may be quoted.
+func readEnvFile(filename string) ([][2]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var vars [][2]string
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", filename, n)
+		}
+
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		vars = append(vars, [2]string{key, value})
+	}
+
+	return vars, scanner.Err()
+}
+
+// set key to value in environment env, replacing any existing value
+func setEnv(env []string, key, value string) []string {
+	prefix := key + "="
+	for i, kv := range env {
+		if strings.HasPrefix(kv, prefix) {
+			env[i] = prefix + value
+			return env
+		}
+	}
+
+	return append(env, prefix+value)
+}
+
+// lookup credential to execute a process as username and group, by name or id.
+// returns the home directory of the user, if any.
+func lookupCredential(username, group string) (*syscall.Credential, string, error) {
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	var home string
+
+	if username != "" {
+		u, err := user.Lookup(username)
+		if _, ok := err.(user.UnknownUserError); ok {
+			u, err = user.LookupId(username)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("unknown user %s: %s", username, err)
+		}
+
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, "", fmt.Errorf("user %s has non-numeric uid %s", username, u.Uid)
+		}
+
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, "", fmt.Errorf("user %s has non-numeric gid %s", username, u.Gid)
+		}
+
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+		home = u.HomeDir
+
+		// supplementary groups of user
+		groupIds, err := u.GroupIds()
+		if err == nil {
+			for _, id := range groupIds {
+				gid, err := strconv.ParseUint(id, 10, 32)
+				if err == nil {
+					credential.Groups = append(credential.Groups, uint32(gid))
+				}
+			}
+		}
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if _, ok := err.(user.UnknownGroupError); ok {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("unknown group %s: %s", group, err)
+		}
+
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, "", fmt.Errorf("group %s has non-numeric gid %s", group, g.Gid)
+		}
+
+		credential.Gid = uint32(gid)
+	}
+
+	return credential, home, nil
+}
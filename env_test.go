@@ -0,0 +1,73 @@
+package buddha
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_env")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("# comment\n\nA=1\nexport B = two words\nC='quoted'\nD=a=b\n")
+	file.Close()
+
+	vars, err := readEnvFile(file.Name())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := [][2]string{{"A", "1"}, {"B", "two words"}, {"C", "quoted"}, {"D", "a=b"}}
+	if len(vars) != len(expected) {
+		t.Fatal("expected 4 variables, got", vars)
+	}
+
+	for i := range expected {
+		if vars[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], vars[i])
+		}
+	}
+}
+
+func TestReadEnvFileInvalid(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_env")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("NOT A VARIABLE\n")
+	file.Close()
+
+	if _, err := readEnvFile(file.Name()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	env := []string{"A=1", "AB=2"}
+
+	env = setEnv(env, "A", "3")
+	env = setEnv(env, "C", "4")
+
+	if len(env) != 3 || env[0] != "A=3" || env[1] != "AB=2" || env[2] != "C=4" {
+		t.Fatal("unexpected environment", env)
+	}
+}
+
+func TestLookupCredential(t *testing.T) {
+	credential, _, err := lookupCredential("0", "")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if credential.Uid != 0 {
+		t.Fatal("expected uid 0, got", credential.Uid)
+	}
+
+	if _, _, err := lookupCredential("", "buddha-nonexistent-group"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
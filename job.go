@@ -1,7 +1,9 @@
 package buddha
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -41,11 +43,126 @@ type Job struct {
 	// name of job in logs
 	Name string `json:"name"`
 
+	// variables substituted as ${name} in string fields of the job
+	Vars map[string]string `json:"vars,omitempty"`
+
 	// true if root privileges are required to run
 	Root bool `json:"root"`
 
 	// commands to execute
-	Commands []Command `json:"commands"`
+	Commands Commands `json:"commands"`
+
+	// number or percentage of commands executed at once, default 1
+	Concurrency Amount `json:"concurrency,omitempty"`
+
+	// number or percentage of failed commands tolerated before no further
+	// commands are started, default 0
+	MaxFailures Amount `json:"max_failures,omitempty"`
+
+	// health checks executed once before the first and after the last
+	// command of the job
+	Before Checks `json:"before,omitempty"`
+	After  Checks `json:"after,omitempty"`
+
+	// health checks polled every interval while commands run, aborting the
+	// current command if one fails past its failure budget
+	Invariants Checks `json:"invariants,omitempty"`
+
+	// health check settings of job checks
+	CheckSettings
+
+	// commands to run if after checks fail with --on-after-fail=rollback and
+	// the failing command has no rollback of its own
+	Rollback Commands `json:"rollback,omitempty"`
+
+	// commands run at the end of the job however it ends, including on
+	// failure or interruption
+	Finally Commands `json:"finally,omitempty"`
+}
+
+// checks executed before and after all jobs of a run
+type RunChecks struct {
+	// preflight checks gating the whole run, executed before any job
+	Before Checks `json:"before,omitempty"`
+
+	// checks validating the run, executed after all jobs
+	After Checks `json:"after,omitempty"`
+
+	// health check settings of run checks
+	CheckSettings
+}
+
+// open run checks config from file
+func OpenRunChecksFile(filename string) (*RunChecks, error) {
+	checks := new(RunChecks)
+	err := unmarshalFile(filename, checks)
+	if err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+// return an error if the job is invalid, such as two commands expanded from a
+// template having the same name
+func (j *Job) Validate() error {
+	for _, commands := range []Commands{j.Commands, j.Rollback, j.Finally} {
+		names := make(map[string]bool)
+		for _, cmd := range commands {
+			if cmd.Capture != nil {
+				if err := cmd.Capture.Validate(); err != nil {
+					return fmt.Errorf("job %s: command %s: %s", j.Name, cmd.Name, err)
+				}
+			}
+
+			if cmd.Name == "" {
+				continue
+			}
+
+			if names[cmd.Name] {
+				return fmt.Errorf("job %s: duplicate command name %s", j.Name, cmd.Name)
+			}
+			names[cmd.Name] = true
+		}
+	}
+
+	return nil
+}
+
+// return a copy of the job with command templates of discovered items
+// expanded, or the job itself if it has none
+func (j *Job) Expand(ctx context.Context) (*Job, error) {
+	if !j.Commands.discovers() && !j.Rollback.discovers() && !j.Finally.discovers() {
+		return j, nil
+	}
+
+	expanded := *j
+
+	var err error
+	for _, commands := range []*Commands{&expanded.Commands, &expanded.Rollback, &expanded.Finally} {
+		*commands, err = commands.Expand(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = expanded.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &expanded, nil
+}
+
+// return the first error from validating each job
+func (j Jobs) Validate() error {
+	for _, job := range j {
+		if err := job.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // open job config from reader
@@ -56,6 +173,11 @@ func Open(r io.Reader) (Jobs, error) {
 		return nil, err
 	}
 
+	err = jobs.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	return jobs, nil
 }
 
@@ -94,6 +216,11 @@ func OpenDir(dirname string) (Jobs, error) {
 		jobs = append(jobs, njobs...)
 	}
 
+	err = jobs.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	return jobs, nil
 }
 
@@ -108,6 +235,17 @@ func unmarshalFile(filename string, v interface{}) error {
 	return json.NewDecoder(file).Decode(v)
 }
 
+// return true if element n in array a
+func inIntArray(a []int, n int) bool {
+	for i := 0; i < len(a); i++ {
+		if a[i] == n {
+			return true
+		}
+	}
+
+	return false
+}
+
 // return true if element s in array a
 func inArray(a []string, s string) bool {
 	for i := 0; i < len(a); i++ {
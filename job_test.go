@@ -1,7 +1,9 @@
 package buddha
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -87,3 +89,80 @@ func TestOpenDir(t *testing.T) {
 		t.Fatal("expected 2 jobs, got", l)
 	}
 }
+
+func TestOpenRunChecksFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_run_checks")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`{"before": [{"type": "tcp", "name": "quorum", "addr": "127.0.0.1:8300"}], "failures": 3}`)
+	file.Close()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	checks, err := OpenRunChecksFile(file.Name())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(checks.Before); l != 1 {
+		t.Fatal("expected 1 before check, got", l)
+	}
+
+	if checks.Failures != 3 {
+		t.Fatal("expected 3 failures, got", checks.Failures)
+	}
+}
+
+func TestOpenTemplate(t *testing.T) {
+	jobs, err := OpenFile("example/reload_app_servers.json")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	commands := jobs[0].Commands
+	if l := len(commands); l != 3 {
+		t.Fatal("expected 3 commands, got", l)
+	}
+
+	if name := commands[2].Name; name != "server_8083" {
+		t.Fatal("expected name server_8083, got", name)
+	}
+
+	if arg := commands[1].Args[1]; arg != "app_8082" {
+		t.Fatal("expected arg app_8082, got", arg)
+	}
+
+	if l := len(commands[0].Before); l != 2 {
+		t.Fatal("expected 2 before checks of server_8081, got", l)
+	}
+
+	if path := commands[0].After[0].(CheckHTTP).Path; path != "http://127.0.0.1:8081/health_check" {
+		t.Fatal("expected check path of port 8081, got", path)
+	}
+}
+
+func TestOpenTemplateItems(t *testing.T) {
+	jobs, err := Open(strings.NewReader(`[{"name": "workers", "commands": [
+		{"name": "${item}", "items": ["worker \"a\"", "worker_b"], "path": "restart", "args": ["${item}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if arg := jobs[0].Commands[0].Args[0]; arg != `worker "a"` {
+		t.Fatal("expected escaped item to be substituted, got", arg)
+	}
+}
+
+func TestOpenTemplateCollision(t *testing.T) {
+	_, err := Open(strings.NewReader(`[{"name": "workers", "commands": [
+		{"name": "worker", "items": ["a", "b"], "path": "restart", "args": ["${item}"]}
+	]}]`))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
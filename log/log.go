@@ -39,6 +39,9 @@ var levelPrefix = map[int]string{
 type Logger struct {
 	out io.Writer
 	mu  sync.Mutex
+
+	parent *Logger // logger written to with prefix, nil if none
+	prefix string
 }
 
 // New created a new Logger with w as output.
@@ -61,8 +64,21 @@ func (l *Logger) SetOutput(w io.Writer) {
 	l.out = w
 }
 
+// WithPrefix returns a Logger writing to l with prefix following the level
+// prefix of each line, for example to distinguish concurrent commands.
+func (l *Logger) WithPrefix(prefix string) *Logger {
+	return &Logger{
+		parent: l,
+		prefix: strings.Replace(prefix, "%", "%%", -1) + " ",
+	}
+}
+
 // Print to output with level, format and values. returns bytes written or error.
 func (l *Logger) Print(level int, format string, v ...interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.Print(level, l.prefix+format, v...)
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -68,3 +68,17 @@ func TestLoggerFormat(t *testing.T) {
 		t.Fatalf("expected '!!! foo', got '%s'", s)
 	}
 }
+
+func TestLoggerWithPrefix(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	l := New(buf).WithPrefix("[app_100%]")
+
+	_, err := l.Println(2, "hello %s", "world")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if s := buf.String(); s != "--> [app_100%] hello world\r\n" {
+		t.Fatalf("expected '--> [app_100%%] hello world\r\n', got '%s'", s)
+	}
+}
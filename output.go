@@ -0,0 +1,280 @@
+package buddha
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maximum time to wait for output after a command exits, for example when a
+// background process it started still holds its stdout open
+var outputWaitDelay = 1 * time.Second
+
+// lines of output longer than this are truncated
+var maxLineLength = 64 * 1024
+
+// default number of lines of output kept for error reports
+const DefaultOutputLines = 20
+
+// output streams
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// line of command output
+type OutputLine struct {
+	Stream string // Stdout or Stderr
+	Text   string
+}
+
+func (l OutputLine) String() string {
+	return l.Stream + ": " + l.Text
+}
+
+// error returned when command output fails an output assertion
+type OutputError struct {
+	Pattern string // pattern failing the assertion
+	Line    string // offending line, empty if a required pattern did not match
+}
+
+func (e OutputError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("output did not match required pattern %q", e.Pattern)
+	}
+
+	return fmt.Sprintf("output matched failure pattern %q: %q", e.Pattern, e.Line)
+}
+
+// reads command output line by line from pipes owned by buddha, so output is
+// read completely before the command returns, evaluating output assertions
+// and keeping the last lines of output
+type output struct {
+	stdout func(line string) // called for each line of stdout, may be nil
+	stderr func(line string) // called for each line of stderr, may be nil
+
+	tail  []OutputLine // last lines of output, oldest first
+	lines int          // maximum length of tail
+
+	capture bool         // keep all of stdout
+	all     bytes.Buffer // stdout kept when capturing
+
+	fail     []*regexp.Regexp
+	require  []*regexp.Regexp
+	matched  []bool       // required patterns which have matched
+	failLine *OutputError // first line matching a failure pattern
+
+	mu      sync.Mutex // serialises line handling between readers
+	wg      sync.WaitGroup
+	readers []*os.File
+	writers []*os.File
+}
+
+func newOutput(c Command) (*output, error) {
+	o := &output{
+		stdout: c.Stdout,
+		stderr: c.Stderr,
+		lines:  c.OutputLines,
+
+		capture: c.Capture != nil,
+	}
+
+	// stderr is passed to the stdout func when no stderr func is given
+	if o.stderr == nil {
+		o.stderr = c.Stdout
+	}
+
+	if o.lines == 0 {
+		o.lines = DefaultOutputLines
+	}
+
+	for _, pattern := range c.FailIfOutputMatches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fail_if_output_matches pattern: %s", err)
+		}
+
+		o.fail = append(o.fail, re)
+	}
+
+	for _, pattern := range c.RequireOutputMatches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid require_output_matches pattern: %s", err)
+		}
+
+		o.require = append(o.require, re)
+	}
+
+	o.matched = make([]bool, len(o.require))
+
+	return o, nil
+}
+
+// return the write end of a new pipe for stream to be passed to the command,
+// lines written to it are read in the background
+func (o *output) Pipe(stream string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	o.readers = append(o.readers, r)
+	o.writers = append(o.writers, w)
+
+	o.wg.Add(1)
+	go o.read(r, stream)
+
+	return w, nil
+}
+
+// close write ends of pipes once they have been passed to the started
+// command, so readers see EOF when the command exits
+func (o *output) CloseWriters() {
+	for _, w := range o.writers {
+		w.Close()
+	}
+}
+
+// wait for readers to reach EOF, closing the pipes if output is still open
+// after delay
+func (o *output) Wait(delay time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(delay):
+		for _, r := range o.readers {
+			r.Close()
+		}
+		<-done
+	}
+
+	for _, r := range o.readers {
+		r.Close()
+	}
+}
+
+// return the last lines of output
+func (o *output) Tail() []OutputLine {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]OutputLine(nil), o.tail...)
+}
+
+// return all of stdout if captured
+func (o *output) Stdout() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.all.String()
+}
+
+// return an OutputError if output failed an output assertion
+func (o *output) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failLine != nil {
+		return *o.failLine
+	}
+
+	for i, matched := range o.matched {
+		if !matched {
+			return OutputError{Pattern: o.require[i].String()}
+		}
+	}
+
+	return nil
+}
+
+// read lines from r until EOF. lines longer than maxLineLength are truncated
+// and the remainder discarded.
+func (o *output) read(r io.Reader, stream string) {
+	defer o.wg.Done()
+
+	reader := bufio.NewReader(r)
+	for {
+		line, truncated, err := readLine(reader, maxLineLength)
+		if len(line) > 0 || err == nil {
+			if truncated {
+				line += " [truncated]"
+			}
+
+			o.line(OutputLine{Stream: stream, Text: line})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read a line from r, without its line ending, of at most max bytes
+func readLine(r *bufio.Reader, max int) (string, bool, error) {
+	var line []byte
+	truncated := false
+
+	for {
+		p, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return string(line), truncated, err
+		}
+
+		if n := max - len(line); n < len(p) {
+			p = p[:n]
+			truncated = true
+		}
+		line = append(line, p...)
+
+		if !isPrefix {
+			return string(line), truncated, nil
+		}
+	}
+}
+
+func (o *output) line(line OutputLine) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	fn := o.stdout
+	if line.Stream == Stderr {
+		fn = o.stderr
+	}
+
+	if fn != nil {
+		fn(line.Text)
+	}
+
+	if len(o.tail) == o.lines {
+		o.tail = append(o.tail[:0], o.tail[1:]...)
+	}
+	o.tail = append(o.tail, line)
+
+	if o.capture && line.Stream == Stdout {
+		o.all.WriteString(line.Text)
+		o.all.WriteByte('\n')
+	}
+
+	for _, re := range o.fail {
+		if o.failLine == nil && re.MatchString(line.Text) {
+			o.failLine = &OutputError{Pattern: re.String(), Line: line.Text}
+		}
+	}
+
+	for i, re := range o.require {
+		if !o.matched[i] && re.MatchString(line.Text) {
+			o.matched[i] = true
+		}
+	}
+}
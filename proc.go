@@ -0,0 +1,285 @@
+package buddha
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// root of the proc filesystem, overridden in tests
+var procRoot = "/proc"
+
+// tcp socket states as reported by /proc/net/tcp
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// tcp socket entry from /proc/net/tcp or /proc/net/tcp6
+type tcpSocket struct {
+	LocalPort int
+	State     string
+	Inode     string
+}
+
+// read ipv4 and ipv6 tcp sockets from the proc filesystem
+func readTCPSockets() ([]tcpSocket, error) {
+	var sockets []tcpSocket
+
+	for _, name := range []string{"tcp", "tcp6"} {
+		s, err := readTCPSocketFile(filepath.Join(procRoot, "net", name))
+		if os.IsNotExist(err) {
+			// ipv6 may be disabled
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sockets = append(sockets, s...)
+	}
+
+	return sockets, nil
+}
+
+func readTCPSocketFile(filename string) ([]tcpSocket, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []tcpSocket
+
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		// skip header
+		if i == 0 {
+			continue
+		}
+
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("malformed line in %s: %s", filename, scanner.Text())
+		}
+
+		colon := strings.LastIndex(fields[1], ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("malformed local address in %s: %s", filename, fields[1])
+		}
+
+		port, err := strconv.ParseInt(fields[1][colon+1:], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed local port in %s: %s", filename, fields[1])
+		}
+
+		state, ok := tcpStates[strings.ToUpper(fields[3])]
+		if !ok {
+			state = fields[3]
+		}
+
+		sockets = append(sockets, tcpSocket{
+			LocalPort: int(port),
+			State:     state,
+			Inode:     fields[9],
+		})
+	}
+
+	return sockets, scanner.Err()
+}
+
+// return true if s is a known tcp state name
+func validTCPState(s string) bool {
+	for _, state := range tcpStates {
+		if state == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// return the set of socket inodes held open by process pid
+func processSocketInodes(pid int) (map[string]bool, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid), "fd")
+
+	fds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := make(map[string]bool)
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+		if err != nil {
+			// fd closed since directory was read
+			continue
+		}
+
+		// socket links are of the form socket:[inode]
+		if strings.HasPrefix(link, "socket:[") && strings.HasSuffix(link, "]") {
+			inodes[link[8:len(link)-1]] = true
+		}
+	}
+
+	return inodes, nil
+}
+
+// length to which the kernel truncates /proc/<pid>/comm
+const maxCommLength = 15
+
+// return the pids of all processes whose command name is name. names longer
+// than comm allows are matched against the program name of the command line.
+func findProcesses(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		comm, err := ioutil.ReadFile(filepath.Join(procRoot, entry.Name(), "comm"))
+		if err != nil {
+			// process exited since directory was read
+			continue
+		}
+
+		command := strings.TrimSpace(string(comm))
+		if len(name) > maxCommLength && len(command) == maxCommLength && strings.HasPrefix(name, command) {
+			command = readProgramName(entry.Name())
+		}
+
+		if command == name {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids, nil
+}
+
+// return the base name of the program in the command line of pid, which
+// processes may rewrite as a single string of arguments
+func readProgramName(pid string) string {
+	cmdline, err := ioutil.ReadFile(filepath.Join(procRoot, pid, "cmdline"))
+	if err != nil {
+		return ""
+	}
+
+	fields := strings.Fields(strings.Split(string(cmdline), "\x00")[0])
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return filepath.Base(fields[0])
+}
+
+// read process id from pid file
+func readPidFile(filename string) (int, error) {
+	p, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(p)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file %s: %s", filename, err)
+	}
+
+	return pid, nil
+}
+
+// read available memory in bytes from /proc/meminfo
+func readMemAvailable() (ByteSize, error) {
+	file, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// MemAvailable:    1234567 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed MemAvailable in meminfo: %s", scanner.Text())
+		}
+
+		return ByteSize(kb) * Kilobyte, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("MemAvailable not found in meminfo")
+}
+
+// read 1, 5 and 15 minute load averages from /proc/loadavg
+func readLoadAverage() ([3]float64, error) {
+	var load [3]float64
+
+	p, err := ioutil.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return load, err
+	}
+
+	fields := strings.Fields(string(p))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed loadavg: %s", p)
+	}
+
+	for i := 0; i < 3; i++ {
+		load[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("malformed loadavg: %s", p)
+		}
+	}
+
+	return load, nil
+}
+
+// read the start time of process pid, in clock ticks since boot
+func processStartTime(pid int) (string, error) {
+	p, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", err
+	}
+
+	// the command name is in parentheses and may itself contain spaces or
+	// parentheses, fields are counted from after the last closing parenthesis
+	i := strings.LastIndex(string(p), ")")
+	if i < 0 {
+		return "", fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	// state is field 3 and starttime is field 22
+	fields := strings.Fields(string(p[i+1:]))
+	if len(fields) < 20 {
+		return "", fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	return fields[19], nil
+}
@@ -0,0 +1,109 @@
+package buddha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:C350 01 00000000:00000000 00:00000000 00000000  1000        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 0100007F:C351 01 00000000:00000000 00:00000000 00000000  1000        0 1003 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:1F91 0100007F:C352 01 00000000:00000000 00:00000000 00000000  1000        0 1004 1 0000000000000000 20 4 30 10 -1
+`
+
+var testProcNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 2001 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000001000000:1F90 00000000000000000000000001000000:C353 01 00000000:00000000 00:00000000 00000000  1000        0 2002 1 0000000000000000 20 4 30 10 -1
+`
+
+// create a fake proc filesystem from a map of relative paths to contents,
+// returning a function restoring the original proc root
+func fakeProc(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "buddha_proc")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	orig := procRoot
+	procRoot = dir
+
+	return dir, func() {
+		procRoot = orig
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReadTCPSockets(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"net/tcp":  testProcNetTCP,
+		"net/tcp6": testProcNetTCP6,
+	})
+	defer restore()
+
+	sockets, err := readTCPSockets()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(sockets); l != 6 {
+		t.Fatal("expected 6 sockets, got", l)
+	} else if s := sockets[0]; s.LocalPort != 8080 || s.State != "LISTEN" || s.Inode != "1001" {
+		t.Fatalf("unexpected socket[0] %+v", s)
+	} else if s := sockets[5]; s.LocalPort != 8080 || s.State != "ESTABLISHED" || s.Inode != "2002" {
+		t.Fatalf("unexpected socket[5] %+v", s)
+	}
+}
+
+func TestReadTCPSocketsNoIPv6(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"net/tcp": testProcNetTCP,
+	})
+	defer restore()
+
+	sockets, err := readTCPSockets()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(sockets); l != 4 {
+		t.Fatal("expected 4 sockets, got", l)
+	}
+}
+
+func TestFindProcessesLongName(t *testing.T) {
+	_, restore := fakeProc(t, map[string]string{
+		"100/comm":    "unicorn_rails_w\n",
+		"100/cmdline": "/usr/local/bin/unicorn_rails_worker\x00-c\x00unicorn.rb\x00",
+		"200/comm":    "unicorn_rails_w\n",
+		"200/cmdline": "unicorn_rails_worker[1] -c unicorn.rb",
+		"300/comm":    "unicorn_rails_w\n",
+		"300/cmdline": "unicorn_rails_webserver\x00",
+	})
+	defer restore()
+
+	pids, err := findProcesses("unicorn_rails_worker")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(pids) != 1 || pids[0] != 100 {
+		t.Fatal("expected pid 100, got", pids)
+	}
+}
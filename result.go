@@ -0,0 +1,137 @@
+package buddha
+
+import (
+	"time"
+)
+
+// outcome of a check
+type Outcome int
+
+const (
+	OutcomePass  Outcome = iota // check passed
+	OutcomeFalse                // check returned CheckFalse
+	OutcomeError                // check returned an unexpected error
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomePass:
+		return "pass"
+	case OutcomeFalse:
+		return "false"
+	case OutcomeError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// checks which can describe their last execution implement Detailer
+type Detailer interface {
+	// additional key value details of the last execution
+	Details() map[string]string
+}
+
+// result of executing a check, including any retries
+type CheckResult struct {
+	// name of check
+	Check string
+
+	// outcome of final attempt
+	Outcome Outcome
+
+	// true if retrying cannot change a false outcome
+	Final bool
+
+	// message from final attempt, empty if check passed
+	Message string
+
+	// error from final attempt, nil if check passed
+	Err error
+
+	// number of attempts made
+	Attempts int
+
+	// duration of final attempt
+	Latency time.Duration
+
+	// optional details from the check
+	Details map[string]string
+}
+
+// build result of a single check attempt from its returned error
+func NewCheckResult(check Check, err error, latency time.Duration) CheckResult {
+	result := CheckResult{
+		Check:    check.String(),
+		Outcome:  OutcomePass,
+		Err:      err,
+		Attempts: 1,
+		Latency:  latency,
+	}
+
+	if err != nil {
+		result.Message = err.Error()
+
+		switch err.(type) {
+		case CheckFalse:
+			result.Outcome = OutcomeFalse
+		case CheckFalseFinal:
+			result.Outcome = OutcomeFalse
+			result.Final = true
+		default:
+			result.Outcome = OutcomeError
+		}
+	}
+
+	if d, ok := check.(Detailer); ok {
+		result.Details = d.Details()
+	}
+
+	return result
+}
+
+// results of checks, in the order the checks are defined
+type CheckResults []CheckResult
+
+// return true if there are results and none passed
+func (r CheckResults) AllFalse() bool {
+	if len(r) == 0 {
+		return false
+	}
+
+	for _, result := range r {
+		if result.Outcome == OutcomePass {
+			return false
+		}
+	}
+
+	return true
+}
+
+// return true if any result did not pass
+func (r CheckResults) AnyFalse() bool {
+	return len(r.Failed()) > 0
+}
+
+// return results which did not pass
+func (r CheckResults) Failed() CheckResults {
+	var failed CheckResults
+	for _, result := range r {
+		if result.Outcome != OutcomePass {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// return the error of the first result with an unexpected error
+func (r CheckResults) Err() error {
+	for _, result := range r {
+		if result.Outcome == OutcomeError {
+			return result.Err
+		}
+	}
+
+	return nil
+}
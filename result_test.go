@@ -0,0 +1,66 @@
+package buddha
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewCheckResult(t *testing.T) {
+	c := CheckTCP{Name: "foo"}
+
+	r1 := NewCheckResult(c, nil, time.Second)
+	if r1.Check != "foo" || r1.Outcome != OutcomePass || r1.Message != "" || r1.Latency != time.Second {
+		t.Fatalf("unexpected result %+v", r1)
+	}
+
+	r2 := NewCheckResult(c, CheckFalse("connection refused"), 0)
+	if r2.Outcome != OutcomeFalse || r2.Message != "connection refused" {
+		t.Fatalf("unexpected result %+v", r2)
+	}
+
+	r3 := NewCheckResult(c, errors.New("boom"), 0)
+	if r3.Outcome != OutcomeError || r3.Message != "boom" {
+		t.Fatalf("unexpected result %+v", r3)
+	}
+}
+
+func TestCheckResultsAllFalse(t *testing.T) {
+	if (CheckResults{}).AllFalse() {
+		t.Fatal("expected empty results to not be all false")
+	}
+
+	r := CheckResults{{Outcome: OutcomeFalse}, {Outcome: OutcomeError}}
+	if !r.AllFalse() {
+		t.Fatal("expected results to be all false")
+	}
+
+	r = append(r, CheckResult{Outcome: OutcomePass})
+	if r.AllFalse() {
+		t.Fatal("expected results to not be all false")
+	}
+}
+
+func TestCheckResultsAnyFalse(t *testing.T) {
+	r := CheckResults{{Check: "a", Outcome: OutcomePass}, {Check: "b", Outcome: OutcomeFalse}}
+	if !r.AnyFalse() {
+		t.Fatal("expected results to be any false")
+	}
+
+	if failed := r.Failed(); len(failed) != 1 || failed[0].Check != "b" {
+		t.Fatal("expected check b to have failed, got", failed)
+	}
+
+	if (CheckResults{{Outcome: OutcomePass}}).AnyFalse() {
+		t.Fatal("expected results to not be any false")
+	}
+}
+
+func TestCheckResultsErr(t *testing.T) {
+	err := errors.New("boom")
+	r := CheckResults{{Outcome: OutcomeFalse}, {Outcome: OutcomeError, Err: err}}
+
+	if r.Err() != err {
+		t.Fatal("expected boom, got", r.Err())
+	}
+}
@@ -0,0 +1,91 @@
+package buddha
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semantic version, see http://semver.org
+type semver struct {
+	Major, Minor, Patch int
+	Prerelease          []string
+}
+
+// parse semantic version, allowing a leading v and ignoring build metadata
+func parseSemver(s string) (semver, error) {
+	var v semver
+
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(str, "+"); i >= 0 {
+		str = str[:i]
+	}
+
+	if i := strings.Index(str, "-"); i >= 0 {
+		v.Prerelease = strings.Split(str[i+1:], ".")
+		str = str[:i]
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid semantic version: %s", s)
+	}
+
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		var err error
+		*n, err = strconv.Atoi(parts[i])
+		if err != nil || *n < 0 {
+			return v, fmt.Errorf("invalid semantic version: %s", s)
+		}
+	}
+
+	return v, nil
+}
+
+// compare precedence of versions, returning -1, 0 or 1
+func (v semver) Compare(o semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	// a version without prerelease has higher precedence
+	if len(v.Prerelease) == 0 || len(o.Prerelease) == 0 {
+		return sign(len(o.Prerelease) - len(v.Prerelease))
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		if a == b {
+			continue
+		}
+
+		an, aerr := strconv.Atoi(a)
+		bn, berr := strconv.Atoi(b)
+		switch {
+		case aerr == nil && berr == nil:
+			return sign(an - bn)
+		case aerr == nil:
+			// numeric identifiers have lower precedence
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			return sign(strings.Compare(a, b))
+		}
+	}
+
+	return sign(len(v.Prerelease) - len(o.Prerelease))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
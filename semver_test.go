@@ -0,0 +1,58 @@
+package buddha
+
+import (
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	v, err := parseSemver("v1.2.3-rc.1+build.5")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if v.Major != 1 || v.Minor != 2 || v.Patch != 3 {
+		t.Fatalf("unexpected version %+v", v)
+	} else if len(v.Prerelease) != 2 || v.Prerelease[0] != "rc" || v.Prerelease[1] != "1" {
+		t.Fatalf("unexpected prerelease %+v", v.Prerelease)
+	}
+
+	for _, s := range []string{"1.2", "1.2.x", "latest"} {
+		if _, err := parseSemver(s); err == nil {
+			t.Fatal("expected error parsing", s)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// in ascending order of precedence
+	versions := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+	}
+
+	for i := 0; i < len(versions)-1; i++ {
+		a, _ := parseSemver(versions[i])
+		b, _ := parseSemver(versions[i+1])
+
+		if c := a.Compare(b); c != -1 {
+			t.Fatalf("expected %s < %s, got %d", versions[i], versions[i+1], c)
+		} else if c := b.Compare(a); c != 1 {
+			t.Fatalf("expected %s > %s, got %d", versions[i+1], versions[i], c)
+		}
+	}
+
+	a, _ := parseSemver("v1.0.0+build.1")
+	b, _ := parseSemver("1.0.0+build.2")
+	if c := a.Compare(b); c != 0 {
+		t.Fatal("expected build metadata to be ignored, got", c)
+	}
+}
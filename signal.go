@@ -0,0 +1,47 @@
+package buddha
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parse signal by name, with or without SIG prefix, or number
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	if signal, ok := signals[name]; ok {
+		return signal, nil
+	}
+
+	return 0, fmt.Errorf("unknown signal %s", s)
+}
+
+// return name of signal, or its number if unknown
+func signalName(signal syscall.Signal) string {
+	for name, s := range signals {
+		if s == signal {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(signal))
+}
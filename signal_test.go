@@ -0,0 +1,34 @@
+package buddha
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := map[string]syscall.Signal{
+		"SIGTERM": syscall.SIGTERM,
+		"term":    syscall.SIGTERM,
+		"QUIT":    syscall.SIGQUIT,
+		"9":       syscall.SIGKILL,
+	}
+
+	for s, expected := range tests {
+		signal, err := ParseSignal(s)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		} else if signal != expected {
+			t.Fatalf("expected %s to be %d, got %d", s, expected, signal)
+		}
+	}
+
+	if _, err := ParseSignal("SIGFOO"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	if s := signalName(syscall.SIGTERM); s != "SIGTERM" {
+		t.Fatal("expected SIGTERM, got", s)
+	}
+}
@@ -0,0 +1,279 @@
+package buddha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// placeholder substituted with each item of a command template
+const itemPlaceholder = "${item}"
+
+type Commands []Command
+
+// numeric range of items, inclusive of from and to
+type Range struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	Step int `json:"step,omitempty"` // default 1
+}
+
+// return each number in range as an item
+func (r Range) Items() ([]string, error) {
+	step := r.Step
+	if step == 0 {
+		step = 1
+	}
+
+	if step < 0 || r.To < r.From {
+		return nil, fmt.Errorf("invalid range from %d to %d step %d", r.From, r.To, step)
+	}
+
+	var items []string
+	for i := r.From; i <= r.To; i += step {
+		items = append(items, fmt.Sprint(i))
+	}
+
+	return items, nil
+}
+
+// a command with items or a range is a template, expanded into one command
+// per item with ${item} substituted in its string fields. a command with
+// discover is expanded at run time over the items it reads.
+type commandTemplate struct {
+	Items    []string `json:"items"`
+	Range    *Range   `json:"range"`
+	Discover *Value   `json:"discover"`
+
+	// fail the job if discover reads no items
+	RequireItems bool `json:"require_items"`
+}
+
+// command template expanded at run time over discovered items
+type discovery struct {
+	template     json.RawMessage
+	value        Value
+	requireItems bool
+}
+
+func (c *Commands) UnmarshalJSON(p []byte) error {
+	var raw []json.RawMessage
+	err := json.Unmarshal(p, &raw)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range raw {
+		var template commandTemplate
+		err = json.Unmarshal(r, &template)
+		if err != nil {
+			return err
+		}
+
+		if template.Discover != nil {
+			if template.Items != nil || template.Range != nil {
+				return fmt.Errorf("command template has both discover and items or range")
+			}
+
+			err = template.Discover.Validate()
+			if err != nil {
+				return fmt.Errorf("command template discover: %s", err)
+			}
+
+			// expanded with a placeholder item to validate the template
+			cmd, err := expandCommand(r, itemPlaceholder)
+			if err != nil {
+				return err
+			}
+
+			cmd.discovery = &discovery{
+				template:     r,
+				value:        *template.Discover,
+				requireItems: template.RequireItems,
+			}
+
+			*c = append(*c, cmd)
+			continue
+		}
+
+		items := template.Items
+		if template.Range != nil {
+			if len(items) > 0 {
+				return fmt.Errorf("command template has both items and range")
+			}
+
+			items, err = template.Range.Items()
+			if err != nil {
+				return err
+			}
+		} else if items == nil {
+			// not a template
+			var cmd Command
+			err = json.Unmarshal(r, &cmd)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, cmd)
+			continue
+		}
+
+		if len(items) == 0 {
+			return fmt.Errorf("command template has no items")
+		}
+
+		for _, item := range items {
+			cmd, err := expandCommand(r, item)
+			if err != nil {
+				return err
+			}
+
+			*c = append(*c, cmd)
+		}
+	}
+
+	return nil
+}
+
+// marshal commands, with templates of discovered items as the template they
+// were unmarshaled from so they are discovered again when loaded
+func (c Commands) MarshalJSON() ([]byte, error) {
+	raw := make([]json.RawMessage, len(c))
+	for i, cmd := range c {
+		if cmd.discovery != nil {
+			raw[i] = cmd.discovery.template
+			continue
+		}
+
+		p, err := json.Marshal(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		raw[i] = p
+	}
+
+	return json.Marshal(raw)
+}
+
+// unmarshal command template with ${item} replaced by item
+func expandCommand(template json.RawMessage, item string) (Command, error) {
+	// replace within json strings, so item is escaped as a json string
+	escaped, err := json.Marshal(item)
+	if err != nil {
+		return Command{}, err
+	}
+	escaped = escaped[1 : len(escaped)-1]
+
+	var cmd Command
+	err = json.Unmarshal(bytes.Replace(template, []byte(itemPlaceholder), escaped, -1), &cmd)
+	if err != nil {
+		return Command{}, fmt.Errorf("command template item %s: %s", item, err)
+	}
+
+	return cmd, nil
+}
+
+// return true if any command, or rollback command, is a template of
+// discovered items
+func (c Commands) discovers() bool {
+	for _, cmd := range c {
+		if cmd.discovery != nil || cmd.Rollback.discovers() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// return commands, and their rollback commands, with templates of discovered
+// items expanded. an error is returned if discovery fails, or reads no items
+// when they are required.
+func (c Commands) Expand(ctx context.Context) (Commands, error) {
+	if !c.discovers() {
+		return c, nil
+	}
+
+	var expanded Commands
+	for _, cmd := range c {
+		if cmd.discovery == nil {
+			var err error
+			cmd.Rollback, err = cmd.Rollback.Expand(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			expanded = append(expanded, cmd)
+			continue
+		}
+
+		s, err := cmd.discovery.value.Read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("discovering items of %s: %s", cmd.Name, err)
+		}
+
+		items, err := parseItems(s)
+		if err != nil {
+			return nil, fmt.Errorf("discovering items of %s: %s", cmd.Name, err)
+		}
+
+		if len(items) == 0 && cmd.discovery.requireItems {
+			return nil, fmt.Errorf("discovering items of %s: no items found", cmd.Name)
+		}
+
+		for _, item := range items {
+			cmd, err := expandCommand(cmd.discovery.template, item)
+			if err != nil {
+				return nil, err
+			}
+
+			cmd.Rollback, err = cmd.Rollback.Expand(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			expanded = append(expanded, cmd)
+		}
+	}
+
+	return expanded, nil
+}
+
+// parse discovered items from a JSON array or non-empty lines
+func parseItems(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "[") {
+		var values []interface{}
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %s", err)
+		}
+
+		items := make([]string, len(values))
+		for i, value := range values {
+			switch value := value.(type) {
+			case string:
+				items[i] = value
+			case json.Number:
+				items[i] = value.String()
+			default:
+				return nil, fmt.Errorf("expected JSON array of strings or numbers")
+			}
+		}
+
+		return items, nil
+	}
+
+	var items []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+
+	return items, nil
+}
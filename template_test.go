@@ -0,0 +1,145 @@
+package buddha
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestRangeItems(t *testing.T) {
+	items, err := Range{From: 8081, To: 8085, Step: 2}.Items()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(items) != 3 || items[0] != "8081" || items[2] != "8085" {
+		t.Fatal("expected items 8081, 8083 and 8085, got", items)
+	}
+
+	if _, err := (Range{From: 2, To: 1}).Items(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestCommandsExpand(t *testing.T) {
+	var commands Commands
+	err := json.Unmarshal([]byte(`[
+		{"name": "first", "path": "true"},
+		{"name": "app_${item}", "discover": {"value": "[8081, \"8082\"]"}, "path": "god", "args": ["restart", "app_${item}"]}
+	]`), &commands)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(commands); l != 2 {
+		t.Fatal("expected 2 commands before expansion, got", l)
+	}
+
+	expanded, err := commands.Expand(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(expanded); l != 3 {
+		t.Fatal("expected 3 commands, got", l)
+	}
+
+	if name := expanded[2].Name; name != "app_8082" {
+		t.Fatal("expected name app_8082, got", name)
+	}
+}
+
+func TestCommandsExpandRollback(t *testing.T) {
+	var commands Commands
+	err := json.Unmarshal([]byte(`[
+		{"name": "deploy", "path": "deploy", "rollback": [
+			{"name": "undo_${item}", "discover": {"value": "a\nb"}, "path": "undo", "args": ["${item}"]}
+		]}
+	]`), &commands)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expanded, err := commands.Expand(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	rollback := expanded[0].Rollback
+	if l := len(rollback); l != 2 {
+		t.Fatal("expected 2 rollback commands, got", l)
+	} else if arg := rollback[1].Args[0]; arg != "b" {
+		t.Fatal("expected arg b, got", arg)
+	}
+
+	// the template itself is left unexpanded
+	if l := len(commands[0].Rollback); l != 1 {
+		t.Fatal("expected template rollback command, got", l)
+	}
+}
+
+func TestCommandsMarshalJSON(t *testing.T) {
+	var commands Commands
+	err := json.Unmarshal([]byte(`[
+		{"name": "first", "path": "true"},
+		{"name": "app_${item}", "discover": {"value": "8081"}, "require_items": true, "path": "god", "args": ["restart", "app_${item}"]}
+	]`), &commands)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	p, err := json.Marshal(commands)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var reloaded Commands
+	err = json.Unmarshal(p, &reloaded)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !reloaded.discovers() {
+		t.Fatal("expected discovered template to be kept, got", string(p))
+	}
+
+	expanded, err := reloaded.Expand(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if l := len(expanded); l != 2 {
+		t.Fatal("expected 2 commands, got", l)
+	} else if name := expanded[1].Name; name != "app_8081" {
+		t.Fatal("expected name app_8081, got", name)
+	}
+}
+
+func TestCommandsExpandRequireItems(t *testing.T) {
+	var commands Commands
+	err := json.Unmarshal([]byte(`[
+		{"name": "app_${item}", "discover": {"command": ["true"]}, "require_items": true, "path": "god"}
+	]`), &commands)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := commands.Expand(context.Background()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestParseItems(t *testing.T) {
+	items, err := parseItems("app_8081\n\n  app_8082  \n")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(items) != 2 || items[1] != "app_8082" {
+		t.Fatal("expected items app_8081 and app_8082, got", items)
+	}
+
+	if _, err := parseItems(`[{"name": "app_8081"}]`); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
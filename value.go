@@ -0,0 +1,208 @@
+package buddha
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// a single value read from the system, such as a version. exactly one of
+// value, url, file, command or pid_file must be set.
+type Value struct {
+	// literal value
+	Literal string `json:"value,omitempty"`
+
+	// url to GET, the value is the response body
+	URL string `json:"url,omitempty"`
+
+	// path to file, the value is its contents
+	File string `json:"file,omitempty"`
+
+	// command and arguments to execute, the value is its stdout
+	Command []string `json:"command,omitempty"`
+
+	// path to pid file, the value is the start time of the process
+	PidFile string `json:"pid_file,omitempty"`
+
+	// dotted path to a field when the value is a JSON document, e.g. build.version
+	Field string `json:"field,omitempty"`
+
+	// replace the value with its digest, sha256 or md5
+	Digest string `json:"digest,omitempty"`
+}
+
+func (v Value) Validate() error {
+	sources := 0
+	for _, set := range []bool{v.Literal != "", v.URL != "", v.File != "", len(v.Command) > 0, v.PidFile != ""} {
+		if set {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return fmt.Errorf("expected exactly one of value, url, file, command or pid_file")
+	}
+
+	if v.Digest != "" && v.Digest != "sha256" && v.Digest != "md5" {
+		return fmt.Errorf("unknown digest %s, expected sha256 or md5", v.Digest)
+	}
+
+	return nil
+}
+
+// read value, trimming surrounding whitespace
+func (v Value) Read(ctx context.Context) (string, error) {
+	s, err := v.read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch v.Digest {
+	case "sha256":
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(s))), nil
+	case "md5":
+		return fmt.Sprintf("%x", md5.Sum([]byte(s))), nil
+	}
+
+	return s, nil
+}
+
+func (v Value) read(ctx context.Context) (string, error) {
+	var p []byte
+	var err error
+
+	switch {
+	case v.Literal != "":
+		p = []byte(v.Literal)
+
+	case v.URL != "":
+		p, err = readURL(ctx, v.URL)
+
+	case v.File != "":
+		p, err = ioutil.ReadFile(v.File)
+
+	case len(v.Command) > 0:
+		p, err = exec.CommandContext(ctx, v.Command[0], v.Command[1:]...).Output()
+		if err != nil {
+			err = fmt.Errorf("command `%s` failed: %s", strings.Join(v.Command, " "), err)
+		}
+
+	case v.PidFile != "":
+		var pid int
+		pid, err = readPidFile(v.PidFile)
+		if err == nil {
+			return processStartTime(pid)
+		}
+
+	default:
+		err = fmt.Errorf("no value source")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if v.Field != "" {
+		return jsonField(p, v.Field)
+	}
+
+	return strings.TrimSpace(string(p)), nil
+}
+
+// describe value source in logs
+func (v Value) String() string {
+	var s string
+
+	switch {
+	case v.Literal != "":
+		return strconv.Quote(v.Literal)
+	case v.URL != "":
+		s = v.URL
+	case v.File != "":
+		s = v.File
+	case len(v.Command) > 0:
+		s = "`" + strings.Join(v.Command, " ") + "`"
+	case v.PidFile != "":
+		s = "start time of " + v.PidFile
+	}
+
+	if v.Field != "" {
+		s += " field " + v.Field
+	}
+
+	if v.Digest != "" {
+		s += " " + v.Digest
+	}
+
+	return s
+}
+
+func readURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building http request failed %s", err)
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s returned status code %d", url, res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// extract a field from a JSON document by dotted path, indexing arrays by number
+func jsonField(p []byte, path string) (string, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid JSON document: %s", err)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("field %s not found", path)
+			}
+			doc = value
+
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("field %s not found", path)
+			}
+			doc = node[i]
+
+		default:
+			return "", fmt.Errorf("field %s not found", path)
+		}
+	}
+
+	switch value := doc.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case nil:
+		return "", fmt.Errorf("field %s is null", path)
+	default:
+		p, err := json.Marshal(value)
+		return string(p), err
+	}
+}
@@ -0,0 +1,133 @@
+package buddha
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestValueValidate(t *testing.T) {
+	v1 := Value{}
+	if err := v1.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	v2 := Value{Literal: "1.0.0", File: "/etc/version"}
+	if err := v2.Validate(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	v3 := Value{URL: "http://127.0.0.1:8080/health", Field: "version"}
+	if err := v3.Validate(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestValueReadLiteral(t *testing.T) {
+	v := Value{Literal: "1.0.0"}
+
+	s, err := v.Read(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s != "1.0.0" {
+		t.Fatal("expected 1.0.0, got", s)
+	}
+}
+
+func TestValueReadURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"build": {"version": "1.2.3", "number": 42, "tags": ["a", "b"]}}`))
+	}))
+	defer ts.Close()
+
+	tests := map[string]string{
+		"build.version": "1.2.3",
+		"build.number":  "42",
+		"build.tags.1":  "b",
+	}
+
+	for field, expected := range tests {
+		v := Value{URL: ts.URL, Field: field}
+
+		s, err := v.Read(context.Background())
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		} else if s != expected {
+			t.Fatalf("expected field %s to be %s, got %s", field, expected, s)
+		}
+	}
+
+	v := Value{URL: ts.URL, Field: "build.missing"}
+	if _, err := v.Read(context.Background()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestValueReadFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "buddha_value")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("2.0.0\n")
+	file.Close()
+
+	v := Value{File: file.Name()}
+
+	s, err := v.Read(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s != "2.0.0" {
+		t.Fatal("expected 2.0.0, got", s)
+	}
+}
+
+func TestValueReadCommand(t *testing.T) {
+	v1 := Value{Command: []string{"echo", "3.0.0"}}
+
+	s, err := v1.Read(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s != "3.0.0" {
+		t.Fatal("expected 3.0.0, got", s)
+	}
+
+	v2 := Value{Command: []string{"false"}}
+	if _, err := v2.Read(context.Background()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestValueReadDigest(t *testing.T) {
+	v := Value{Literal: "hello", Digest: "sha256"}
+
+	s, err := v.Read(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatal("unexpected sha256 digest", s)
+	}
+}
+
+func TestValueReadPidFile(t *testing.T) {
+	dir, restore := fakeProc(t, map[string]string{
+		"100/stat": "100 (my app (v2)) S 1 100 100 0 -1 4194560 1000 0 0 0 10 5 0 0 20 0 4 0 987654 123456789 2048\n",
+	})
+	defer restore()
+
+	pidFile := dir + "/app.pid"
+	ioutil.WriteFile(pidFile, []byte("100\n"), 0644)
+
+	v := Value{PidFile: pidFile}
+
+	s, err := v.Read(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if s != "987654" {
+		t.Fatal("expected start time 987654, got", s)
+	}
+}
@@ -0,0 +1,221 @@
+package buddha
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// lookup of variable values by name. variables are substituted in the string
+// fields of a job as ${name}, the ${item} placeholder of command templates is
+// not a variable and $${ is replaced by a literal ${.
+type vars func(name string) (string, bool)
+
+// error returned when variables are referenced but not defined
+type UndefinedVarsError struct {
+	Job   string
+	Names []string
+}
+
+func (e UndefinedVarsError) Error() string {
+	return fmt.Sprintf("job %s: undefined variables: %s", e.Job, strings.Join(e.Names, ", "))
+}
+
+// substitute variables in the string fields of each job, taken from
+// overrides, then the vars of the job, then the environment
+func (j Jobs) Resolve(overrides map[string]string) error {
+	for _, job := range j {
+		if err := job.Resolve(overrides); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// substitute variables in the string fields of the job, taken from
+// overrides, then the vars of the job, then the environment. an
+// UndefinedVarsError is returned if any are not defined. the job is validated
+// again once substituted, as variables may produce duplicate command names.
+func (j *Job) Resolve(overrides map[string]string) error {
+	undefined := make(map[string]bool)
+	captures := j.captureVars()
+
+	// job vars may themselves refer to overrides and the environment
+	env := func(name string) (string, bool) {
+		if value, ok := overrides[name]; ok {
+			return value, true
+		}
+
+		return os.LookupEnv(name)
+	}
+
+	jobVars := make(map[string]string, len(j.Vars))
+	for name, value := range j.Vars {
+		jobVars[name] = expandVars(value, env, undefined, false)
+	}
+
+	lookup := func(name string) (string, bool) {
+		// captured variables are substituted at run time
+		if captures[name] {
+			return "${" + name + "}", true
+		}
+
+		if value, ok := overrides[name]; ok {
+			return value, true
+		}
+
+		if value, ok := jobVars[name]; ok {
+			return value, true
+		}
+
+		return os.LookupEnv(name)
+	}
+
+	expand := func(s string) string {
+		return expandVars(s, lookup, undefined, false)
+	}
+
+	// vars are substituted above, and must not be substituted twice
+	original := j.Vars
+	j.Vars = nil
+	resolveStrings(reflect.ValueOf(j), expand)
+	if original != nil {
+		j.Vars = jobVars
+	}
+
+	// templates of discovered items are expanded at run time from json
+	for _, commands := range []Commands{j.Commands, j.Rollback, j.Finally} {
+		commands.resolveDiscovery(lookup, undefined)
+	}
+
+	if len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return UndefinedVarsError{Job: j.Name, Names: names}
+	}
+
+	return j.Validate()
+}
+
+// substitute variables in templates of discovered items
+func (c Commands) resolveDiscovery(lookup vars, undefined map[string]bool) {
+	for _, cmd := range c {
+		if cmd.discovery != nil {
+			template := expandVars(string(cmd.discovery.template), lookup, undefined, true)
+			cmd.discovery.template = json.RawMessage(template)
+
+			resolveStrings(reflect.ValueOf(&cmd.discovery.value), func(s string) string {
+				return expandVars(s, lookup, undefined, false)
+			})
+		}
+
+		cmd.Rollback.resolveDiscovery(lookup, undefined)
+	}
+}
+
+// replace ${name} in s with its value from lookup, recording undefined names.
+// when escape is true values are escaped for use within a json string.
+func expandVars(s string, lookup vars, undefined map[string]bool, escape bool) string {
+	var buf []byte
+
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			buf = append(buf, "${"...)
+			i += 2
+			continue
+		}
+
+		if !strings.HasPrefix(s[i:], "${") {
+			buf = append(buf, s[i])
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			buf = append(buf, s[i:]...)
+			break
+		}
+
+		placeholder := s[i : i+end+1]
+		name := placeholder[2 : len(placeholder)-1]
+		i += end
+
+		if placeholder == itemPlaceholder {
+			buf = append(buf, placeholder...)
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			undefined[name] = true
+			buf = append(buf, placeholder...)
+			continue
+		}
+
+		if escape {
+			p, _ := json.Marshal(value)
+			value = string(p[1 : len(p)-1])
+		}
+
+		buf = append(buf, value...)
+	}
+
+	return string(buf)
+}
+
+// call expand on every settable string within v, following pointers,
+// interfaces, structs, slices and maps
+func resolveStrings(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			resolveStrings(v.Elem(), expand)
+		}
+
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return
+		}
+
+		// values held by an interface cannot be set, so are copied
+		elem := v.Elem()
+		copied := reflect.New(elem.Type()).Elem()
+		copied.Set(elem)
+		resolveStrings(copied, expand)
+		v.Set(copied)
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Field(i); field.CanSet() {
+				resolveStrings(field, expand)
+			}
+		}
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			resolveStrings(v.Index(i), expand)
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := v.MapIndex(key)
+			copied := reflect.New(elem.Type()).Elem()
+			copied.Set(elem)
+			resolveStrings(copied, expand)
+			v.SetMapIndex(key, copied)
+		}
+
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expand(v.String()))
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package buddha
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"port": "8081", "quote": `"a"`}[name]
+		return value, ok
+	}
+
+	tests := map[string]string{
+		"127.0.0.1:${port}":  "127.0.0.1:8081",
+		"app_${item}":        "app_${item}",
+		"$${port} ${port}":   "${port} 8081",
+		"$HOME ${port":       "$HOME ${port",
+		"${port}${port}/new": "80818081/new",
+	}
+
+	for s, expected := range tests {
+		undefined := make(map[string]bool)
+		if v := expandVars(s, lookup, undefined, false); v != expected {
+			t.Fatalf("expected %s to expand to %s, got %s", s, expected, v)
+		} else if len(undefined) > 0 {
+			t.Fatal("unexpected undefined variables", undefined)
+		}
+	}
+
+	undefined := make(map[string]bool)
+	expandVars("${missing}", lookup, undefined, false)
+	if !undefined["missing"] {
+		t.Fatal("expected missing to be undefined")
+	}
+
+	if v := expandVars("${quote}", lookup, undefined, true); v != `\"a\"` {
+		t.Fatal("expected escaped value, got", v)
+	}
+}
+
+func TestJobResolve(t *testing.T) {
+	os.Setenv("BUDDHA_TEST_HOST", "10.0.0.1")
+	defer os.Unsetenv("BUDDHA_TEST_HOST")
+
+	jobs, err := Open(strings.NewReader(`[{"name": "app_${env}", "vars": {"env": "staging", "port": "8080"}, "commands": [
+		{"name": "restart", "path": "restart", "args": ["${env}"], "env": {"PORT": "${port}"},
+		 "after": [{"type": "http", "name": "health", "path": "http://${BUDDHA_TEST_HOST}:${port}/"}]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = jobs.Resolve(map[string]string{"port": "8081"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	job := jobs[0]
+	if job.Name != "app_staging" {
+		t.Fatal("expected name app_staging, got", job.Name)
+	} else if arg := job.Commands[0].Args[0]; arg != "staging" {
+		t.Fatal("expected arg staging, got", arg)
+	} else if port := job.Commands[0].Env["PORT"]; port != "8081" {
+		t.Fatal("expected overridden port 8081, got", port)
+	} else if path := job.Commands[0].After[0].(CheckHTTP).Path; path != "http://10.0.0.1:8081/" {
+		t.Fatal("expected check path from environment and override, got", path)
+	}
+}
+
+func TestJobResolveUndefined(t *testing.T) {
+	jobs, err := Open(strings.NewReader(`[{"name": "app", "commands": [
+		{"name": "restart", "path": "restart", "args": ["${b}", "${a}", "${b}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = jobs.Resolve(nil)
+	if e, ok := err.(UndefinedVarsError); !ok {
+		t.Fatal("expected UndefinedVarsError, got", err)
+	} else if names := strings.Join(e.Names, ","); names != "a,b" {
+		t.Fatal("expected undefined a and b, got", names)
+	}
+}
+
+func TestJobResolveDiscovery(t *testing.T) {
+	jobs, err := Open(strings.NewReader(`[{"name": "app", "vars": {"group": "web"}, "commands": [
+		{"name": "${item}", "discover": {"command": ["echo", "${group}_1"]}, "path": "restart", "args": ["${group}", "${item}"]}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = jobs.Resolve(nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	commands, err := jobs[0].Commands.Expand(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if args := strings.Join(commands[0].Args, " "); args != "web web_1" {
+		t.Fatal("expected args web web_1, got", args)
+	}
+}
+
+func TestJobResolveDuplicateNames(t *testing.T) {
+	jobs, err := Open(strings.NewReader(`[{"name": "app", "vars": {"a": "web", "b": "web"}, "commands": [
+		{"name": "restart_${a}", "path": "restart"},
+		{"name": "restart_${b}", "path": "restart"}
+	]}]`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := jobs.Resolve(nil); err == nil {
+		t.Fatal("expected error for duplicate command names after substitution")
+	}
+}